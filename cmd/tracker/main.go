@@ -35,14 +35,24 @@ func init() {
 
 	rootCmd.PersistentFlags().String("port", "8080", "Port to listen on")
 	rootCmd.PersistentFlags().String("host", "", "Host IP to listen on. If the host is empty it will listen on all IPs")
+	rootCmd.PersistentFlags().String("dbDriver",
+		"sqlite3", "Database driver: sqlite3, postgres, or memory which keeps the statistics until the tracker stops")
 	rootCmd.PersistentFlags().String("dbName",
 		"./stats.db", "Test statistics database")
+	rootCmd.PersistentFlags().String("dbDSN",
+		"", "Connection string of the postgres database")
 	rootCmd.PersistentFlags().String("webTemplate",
 		"index.tmpl", "HTML web template")
 	rootCmd.PersistentFlags().String("styleSheet",
 		"./style.css", "Web cascading style sheet")
 	rootCmd.PersistentFlags().String("destEndpoint",
 		"localhost:8080/action", "endpoint for local test action events")
+	rootCmd.PersistentFlags().Int("maxAttempts",
+		8, "delivery attempts of an event before it is dead")
+	rootCmd.PersistentFlags().Int("flakyWindow",
+		20, "last runs of a test its flakiness is scored over")
+	rootCmd.PersistentFlags().String("adminToken",
+		"", "bearer token of the /api/admin endpoints, they refuse every request without one")
 }
 
 func initConfig() {
@@ -99,7 +109,8 @@ func main() {
 }
 
 // CatchCtrlC function performs a graceful shutdown
-func catchCtrlC(srv *http.Server) {
+// and closes stopped once the requests in flight are done
+func catchCtrlC(srv *http.Server, stopped chan<- struct{}) {
 	sigint := make(chan os.Signal, 1)
 
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
@@ -108,16 +119,33 @@ func catchCtrlC(srv *http.Server) {
 	if err := srv.Shutdown(context.Background()); err != nil {
 		logrus.WithFields(logrus.Fields{"Error": err}).Info("Server shutdown error")
 	}
+	close(stopped)
+}
+
+// openStore opens the store of the configured database driver
+func openStore() (statsdb.Store, error) {
+	switch driver := viper.GetString("dbDriver"); driver {
+	case statsdb.DriverSQLite, statsdb.DriverPostgres:
+		return openDB()
+	case "memory":
+		return statsdb.NewMemStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
 }
 
 func run(cmd *cobra.Command, args []string) {
 	tracker := &trackerapi.Tracker{Wg: sync.WaitGroup{}}
 	defer tracker.Wg.Wait()
-	tracker.DB = statsdb.Open(viper.GetString("dbName"))
-	if tracker.DB == nil {
+	db, err := openStore()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error opening database")
 		return
 	}
-	err := tracker.DB.Setup()
+	tracker.DB = db
+	err = tracker.DB.Setup()
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
@@ -134,8 +162,56 @@ func run(cmd *cobra.Command, args []string) {
 		return
 	}
 	tracker.DestEndpoint = viper.GetString("destEndpoint")
-	tracker.Queue = tracker.EventSink()
-	defer close(tracker.Queue)
+	tracker.MaxAttempts = viper.GetInt("maxAttempts")
+	tracker.FlakyWindow = viper.GetInt("flakyWindow")
+	tracker.AdminToken = viper.GetString("adminToken")
+	if err := viper.UnmarshalKey("services", &tracker.Services); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error reading the services configuration")
+		return
+	}
+	if err := viper.UnmarshalKey("policies", &tracker.Policies); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error reading the policies configuration")
+		return
+	}
+	if err := viper.UnmarshalKey("signing", &tracker.Signing); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error reading the signing key")
+		return
+	}
+	if err := viper.UnmarshalKey("sinks", &tracker.Sinks); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error reading the sinks configuration")
+		return
+	}
+	if err := tracker.SetupSinks(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error setting up the sinks")
+		return
+	}
+	if err := viper.UnmarshalKey("sources", &tracker.Sources); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error reading the sources configuration")
+		return
+	}
+	if err := tracker.SetupSources(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error setting up the sources")
+		return
+	}
+	// the sinks stop before the wait for the local test runs,
+	// which keep storing their events in the outbox
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tracker.Queue = tracker.EventSink(ctx)
 
 	mux := http.NewServeMux()
 	mux.Handle(viper.GetString("styleSheet"),
@@ -146,6 +222,15 @@ func run(cmd *cobra.Command, args []string) {
 	mux.HandleFunc("/", tracker.DefaultPath)
 	mux.HandleFunc("/action", tracker.Action)
 	mux.HandleFunc("/api/stats", tracker.StatsAPI)
+	mux.HandleFunc("/api/stats/", tracker.StatsActionAPI)
+	mux.HandleFunc("/api/stats/trend", tracker.TrendAPI)
+	mux.HandleFunc("/api/verdict/", tracker.VerdictAPI)
+	mux.HandleFunc("/api/admin/outbox", tracker.OutboxAPI)
+	mux.HandleFunc("/api/admin/outbox/", tracker.OutboxAPI)
+	mux.HandleFunc("/api/admin/audit", tracker.AuditAPI)
+	mux.HandleFunc("/api/coverage", tracker.CoverageUpload)
+	mux.HandleFunc("/api/junit", tracker.JUnitUpload)
+	mux.HandleFunc("/api/flaky", tracker.FlakyAPI)
 	mux.HandleFunc("/stats", tracker.StatsWeb)
 
 	svr := &http.Server{
@@ -153,12 +238,16 @@ func run(cmd *cobra.Command, args []string) {
 		Handler: mux,
 	}
 
-	go catchCtrlC(svr)
+	stopped := make(chan struct{})
+	go catchCtrlC(svr, stopped)
 
 	if err := svr.ListenAndServe(); err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
 		}).Info("HTTP Server shutdown response")
+		if err == http.ErrServerClosed {
+			<-stopped
+		}
 		return
 	}
 }
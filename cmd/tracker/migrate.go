@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"ringier/pkg/statsdb"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// migrateCmd command object of the schema migrations
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrates the schema of the database",
+	Long:  "Shows, applies and reverts the versioned migrations of the database schema",
+}
+
+// migrateStatusCmd command object listing the migrations
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Lists the migrations and whether they are applied",
+	Args:  cobra.NoArgs,
+	RunE:  migrateStatus,
+}
+
+// migrateUpCmd command object applying the migrations
+var migrateUpCmd = &cobra.Command{
+	Use:   "up [version]",
+	Short: "Applies the migrations up to a version, the latest by default",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  migrateUp,
+}
+
+// migrateDownCmd command object reverting the migrations
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [version]",
+	Short: "Reverts the migrations down to a version, the previous by default",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  migrateDown,
+}
+
+// init adds the migrate commands
+func init() {
+	migrateCmd.AddCommand(migrateStatusCmd, migrateUpCmd, migrateDownCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+// openDB opens the SQLite or PostgreSQL database without migrating it
+func openDB() (*statsdb.StatsDB, error) {
+	var db *statsdb.StatsDB
+	switch driver := viper.GetString("dbDriver"); driver {
+	case statsdb.DriverSQLite:
+		db = statsdb.Open(viper.GetString("dbName"))
+	case statsdb.DriverPostgres:
+		db = statsdb.OpenDriver(driver, viper.GetString("dbDSN"))
+	default:
+		return nil, fmt.Errorf("database driver %q has no migrations", driver)
+	}
+	if db == nil {
+		return nil, fmt.Errorf("cannot open %s database", viper.GetString("dbDriver"))
+	}
+	return db, nil
+}
+
+// versionArg reads the version argument of a migrate command
+func versionArg(args []string, version int) (int, error) {
+	if len(args) == 0 {
+		return version, nil
+	}
+	v, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("bad version %q", args[0])
+	}
+	return v, nil
+}
+
+func migrateStatus(cmd *cobra.Command, args []string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.DB.Close()
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range status {
+		appliedAt := "pending"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return w.Flush()
+}
+
+func migrateUp(cmd *cobra.Command, args []string) error {
+	version, err := versionArg(args, statsdb.LatestVersion())
+	if err != nil {
+		return err
+	}
+	return migrateTo(version)
+}
+
+func migrateDown(cmd *cobra.Command, args []string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.DB.Close()
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	previous := current - 1
+	if previous < 0 {
+		previous = 0
+	}
+	version, err := versionArg(args, previous)
+	if err != nil {
+		return err
+	}
+	if version > current {
+		return fmt.Errorf("version %d is above the current version %d", version, current)
+	}
+	return migrateTo(version)
+}
+
+// migrateTo migrates the database to a version
+// and prints the version it ends up at
+func migrateTo(version int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.DB.Close()
+	if err := db.Migrate(version); err != nil {
+		return err
+	}
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d\n", current)
+	return nil
+}
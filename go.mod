@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	github.com/google/uuid v1.2.0
+	github.com/lib/pq v1.9.0
 	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/sirupsen/logrus v1.2.0
 	github.com/spf13/cobra v1.1.3
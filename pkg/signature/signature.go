@@ -0,0 +1,139 @@
+// Package signature signs the events posted by the tracker and
+// lets their receivers check that an event comes from the tracker.
+//
+// An event carries three headers: the id of the key it was signed
+// with, the unix time it was sent at and an HMAC SHA256 of the time
+// and the body. A receiver refuses events signed too long ago and
+// events it has seen before.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// KeyIDHeader header naming the key an event is signed with
+	KeyIDHeader = "X-Tracker-Key-Id"
+	// TimestampHeader header with the unix time an event was signed at
+	TimestampHeader = "X-Tracker-Timestamp"
+	// SignatureHeader header with the signature of an event
+	SignatureHeader = "X-Tracker-Signature"
+	// DefaultTolerance how old a signature can be by default
+	DefaultTolerance = 5 * time.Minute
+
+	version = "v1="
+)
+
+var (
+	// ErrMissing the event is not signed
+	ErrMissing = errors.New("signature: missing headers")
+	// ErrUnknownKey the event is signed with a key the receiver does not know
+	ErrUnknownKey = errors.New("signature: unknown key")
+	// ErrExpired the event was signed outside of the tolerance
+	ErrExpired = errors.New("signature: timestamp outside of the tolerance")
+	// ErrMismatch the signature does not match the event
+	ErrMismatch = errors.New("signature: mismatch")
+	// ErrReplayed the event has been received before
+	ErrReplayed = errors.New("signature: replayed")
+)
+
+// Key structure of a signing key
+type Key struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+// Sign returns the signature of a body sent at a time
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return version + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest sets the signature headers of a request with its body
+func (k Key) SignRequest(req *http.Request, body []byte, now time.Time) {
+	timestamp := now.Unix()
+	req.Header.Set(KeyIDHeader, k.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(k.Secret, timestamp, body))
+}
+
+// Verifier structure of the receiving side checking the signatures.
+// It is safe for concurrent use
+type Verifier struct {
+	Keys      map[string]string
+	Tolerance time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewVerifier creates a verifier accepting the secrets of a key id map.
+// Several keys can be accepted at the same time while one is rotated
+func NewVerifier(keys map[string]string, tolerance time.Duration) *Verifier {
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	return &Verifier{Keys: keys, Tolerance: tolerance, seen: map[string]time.Time{}}
+}
+
+// Verify checks the signature headers of an event against its body
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	return v.verify(header, body, time.Now())
+}
+
+func (v *Verifier) verify(header http.Header, body []byte, now time.Time) error {
+	keyID := header.Get(KeyIDHeader)
+	signature := header.Get(SignatureHeader)
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if signature == "" || err != nil {
+		return ErrMissing
+	}
+	secret, ok := v.Keys[keyID]
+	if !ok {
+		return ErrUnknownKey
+	}
+	tolerance := v.tolerance()
+	sent := time.Unix(timestamp, 0)
+	if sent.Before(now.Add(-tolerance)) || sent.After(now.Add(tolerance)) {
+		return ErrExpired
+	}
+	if !strings.HasPrefix(signature, version) ||
+		!hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return ErrMismatch
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen == nil {
+		v.seen = map[string]time.Time{}
+	}
+	for s, at := range v.seen {
+		if at.Before(now.Add(-tolerance)) {
+			delete(v.seen, s)
+		}
+	}
+	if _, ok := v.seen[signature]; ok {
+		return ErrReplayed
+	}
+	v.seen[signature] = sent
+	return nil
+}
+
+// tolerance returns how old a signature can be
+func (v *Verifier) tolerance() time.Duration {
+	if v.Tolerance <= 0 {
+		return DefaultTolerance
+	}
+	return v.Tolerance
+}
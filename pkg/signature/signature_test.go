@@ -0,0 +1,72 @@
+package signature
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSignature_Verify checks the verification of signed events
+func TestSignature_Verify(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	body := []byte(`{"event":"push"}`)
+	key := Key{ID: "k2", Secret: "new"}
+
+	testCases := []struct {
+		name   string
+		header func() http.Header
+		want   error
+	}{
+		{name: "signed", header: func() http.Header { return signed(key, body, now) }, want: nil},
+		{name: "old key", header: func() http.Header { return signed(Key{ID: "k1", Secret: "old"}, body, now) }, want: nil},
+		{name: "unsigned", header: func() http.Header { return http.Header{} }, want: ErrMissing},
+		{name: "unknown key", header: func() http.Header { return signed(Key{ID: "k3", Secret: "new"}, body, now) }, want: ErrUnknownKey},
+		{name: "wrong secret", header: func() http.Header { return signed(Key{ID: "k2", Secret: "old"}, body, now) }, want: ErrMismatch},
+		{name: "too old", header: func() http.Header { return signed(key, body, now.Add(-10*time.Minute)) }, want: ErrExpired},
+		{name: "in the future", header: func() http.Header { return signed(key, body, now.Add(10*time.Minute)) }, want: ErrExpired},
+		{name: "other body", header: func() http.Header { return signed(key, []byte(`{}`), now) }, want: ErrMismatch},
+		{name: "moved timestamp", header: func() http.Header {
+			h := signed(key, body, now)
+			h.Set(TimestampHeader, strconv.FormatInt(now.Unix()+1, 10))
+			return h
+		}, want: ErrMismatch},
+	}
+
+	for _, tc := range testCases {
+		v := NewVerifier(map[string]string{"k1": "old", "k2": "new"}, 0)
+		if got := v.verify(tc.header(), body, now); got != tc.want {
+			t.Errorf("Verifier.Verify(%s): want: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+// TestSignature_replay checks if an event is accepted only once
+func TestSignature_replay(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	body := []byte(`{"event":"push"}`)
+	key := Key{ID: "k1", Secret: "secret"}
+	v := &Verifier{Keys: map[string]string{"k1": "secret"}, Tolerance: time.Minute}
+
+	header := signed(key, body, now)
+	if err := v.verify(header, body, now); err != nil {
+		t.Errorf("Verifier.Verify(): want: %v, got: %v", nil, err)
+	}
+	if err := v.verify(header, body, now.Add(time.Second)); err != ErrReplayed {
+		t.Errorf("Verifier.Verify(): want: %v, got: %v", ErrReplayed, err)
+	}
+	if err := v.verify(signed(key, body, now.Add(time.Second)), body, now.Add(time.Second)); err != nil {
+		t.Errorf("Verifier.Verify(): want: a retry to be accepted, got: %v", err)
+	}
+	v.verify(signed(key, body, now.Add(2*time.Minute)), body, now.Add(2*time.Minute))
+	if len(v.seen) != 1 {
+		t.Errorf("Verifier.Verify(): want: %v remembered signature, got: %v", 1, len(v.seen))
+	}
+}
+
+// signed returns the headers of a body signed with a key
+func signed(key Key, body []byte, now time.Time) http.Header {
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost", nil)
+	key.SignRequest(req, body, now)
+	return req.Header
+}
@@ -0,0 +1,103 @@
+package statsdb
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuthFailure structure of a rejected inbound request
+type AuthFailure struct {
+	ID         int64     `json:"id"`
+	Source     string    `json:"source"`
+	RemoteAddr string    `json:"remote_addr"`
+	Signature  string    `json:"signature"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// maxAuthFailures is the number of rejected requests kept in the audit table,
+// older rows are pruned on insert
+var maxAuthFailures int64 = 1000
+
+const (
+	createAuditSQL = `INSERT INTO auth_failure (
+	source,remote_addr,signature,reason,created_at)
+	VALUES(?,?,?,?,?);
+`
+	selectAuditSQL = `SELECT 
+id,
+source,
+remote_addr,
+signature,
+reason,
+created_at
+FROM auth_failure
+ORDER BY id DESC
+LIMIT ?;
+`
+	pruneAuditSQL = `DELETE FROM auth_failure WHERE id <= ?;
+`
+)
+
+// SaveAuthFailure inserts a rejected request into the audit table
+func (s *StatsDB) SaveAuthFailure(failure *AuthFailure) error {
+	if failure.CreatedAt.IsZero() {
+		failure.CreatedAt = time.Now()
+	}
+	id, err := s.insert(s.createAuditStmt, failure.Source,
+		failure.RemoteAddr,
+		failure.Signature,
+		failure.Reason,
+		failure.CreatedAt.Unix())
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   createAuditSQL,
+		}).Info("Sql error")
+		return err
+	}
+	failure.ID = id
+	if _, err := s.pruneAuditStmt.Exec(id - maxAuthFailures); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   pruneAuditSQL,
+		}).Info("Sql error")
+	}
+	return nil
+}
+
+// GetAuthFailures selects the last rejected requests, newest first
+func (s *StatsDB) GetAuthFailures(limit int) []AuthFailure {
+	rows, err := s.selectAuditStmt.Query(limit)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectAuditSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	defer rows.Close()
+
+	failures := []AuthFailure{}
+	for rows.Next() {
+		failure := AuthFailure{}
+		var createdAt int64
+		err := rows.Scan(&failure.ID,
+			&failure.Source,
+			&failure.RemoteAddr,
+			&failure.Signature,
+			&failure.Reason,
+			&createdAt)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   selectAuditSQL,
+			}).Info("Sql error")
+			return nil
+		}
+		failure.CreatedAt = time.Unix(createdAt, 0)
+		failures = append(failures, failure)
+	}
+	return failures
+}
@@ -0,0 +1,60 @@
+package statsdb
+
+import (
+	"os"
+	"testing"
+)
+
+// TestStatsDB_AuthFailures checks if rejected requests are
+// stored and listed newest first
+func TestStatsDB_AuthFailures(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	for _, reason := range []string{"missing signature", "signature mismatch"} {
+		failure := &AuthFailure{Source: "default", RemoteAddr: "10.0.0.1:4242", Reason: reason}
+		if err := stats.SaveAuthFailure(failure); err != nil || failure.ID == 0 {
+			t.Errorf("StatsDB.SaveAuthFailure(): want: %v, got: %v %v", nil, err, failure.ID)
+		}
+	}
+
+	failures := stats.GetAuthFailures(1)
+	if len(failures) != 1 || failures[0].Reason != "signature mismatch" || failures[0].CreatedAt.IsZero() {
+		t.Errorf("StatsDB.GetAuthFailures(%d): want: the last failure, got: %v", 1, failures)
+	}
+	if failures := stats.GetAuthFailures(10); len(failures) != 2 {
+		t.Errorf("StatsDB.GetAuthFailures(%d): want: %v failures, got: %v", 10, 2, len(failures))
+	}
+}
+
+// TestStatsDB_AuthFailuresPrune checks if only the last rejected
+// requests are kept
+func TestStatsDB_AuthFailuresPrune(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+	defer func(max int64) { maxAuthFailures = max }(maxAuthFailures)
+	maxAuthFailures = 2
+
+	for name, store := range map[string]Store{"StatsDB": stats, "MemStore": NewMemStore()} {
+		for _, reason := range []string{"first", "second", "third"} {
+			store.SaveAuthFailure(&AuthFailure{Source: "default", Reason: reason})
+		}
+		failures := store.GetAuthFailures(10)
+		if len(failures) != 2 || failures[0].Reason != "third" || failures[1].Reason != "second" {
+			t.Errorf("%s.GetAuthFailures(%d): want: the last %d failures, got: %v", name, 10, 2, failures)
+		}
+		if len(failures) == 2 && failures[0].ID != 3 {
+			t.Errorf("%s.SaveAuthFailure(): want: id %v, got: %v", name, 3, failures[0].ID)
+		}
+	}
+}
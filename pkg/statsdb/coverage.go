@@ -0,0 +1,226 @@
+package statsdb
+
+import (
+	"database/sql"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FileCoverage structure of the statement coverage of a source file
+type FileCoverage struct {
+	File       string  `json:"file"`
+	Statements int     `json:"statements"`
+	Covered    int     `json:"covered"`
+	Coverage   float64 `json:"coverage"`
+}
+
+// FuncCoverage structure of the statement coverage of a function
+type FuncCoverage struct {
+	File     string  `json:"file"`
+	Line     int     `json:"line"`
+	Function string  `json:"function"`
+	Coverage float64 `json:"coverage"`
+}
+
+// CoverageReport structure of the detailed coverage of an action
+type CoverageReport struct {
+	Files     []FileCoverage `json:"files"`
+	Functions []FuncCoverage `json:"functions"`
+}
+
+const (
+	createFileSQL = `INSERT INTO file_coverage (
+	action_id,file,statements,covered,coverage)
+	VALUES(?,?,?,?,?);
+`
+	createFuncSQL = `INSERT INTO func_coverage (
+	action_id,file,line,function,coverage)
+	VALUES(?,?,?,?,?);
+`
+	createPackageSQL = `INSERT INTO package_coverage (
+	action_id,package,coverage)
+	VALUES(?,?,?);
+`
+	selectFileSQL = `SELECT 
+file,
+statements,
+covered,
+coverage
+FROM file_coverage
+WHERE action_id = ?
+ORDER BY file;
+`
+	selectFuncSQL = `SELECT 
+file,
+line,
+function,
+coverage
+FROM func_coverage
+WHERE action_id = ?
+ORDER BY file, line;
+`
+	selectPackageSQL = `SELECT 
+package,
+coverage
+FROM package_coverage
+WHERE action_id = ?
+ORDER BY id;
+`
+)
+
+// saveCoverage inserts the package, file and function coverage of an action
+// into the package_coverage, file_coverage and func_coverage tables
+func (s *StatsDB) saveCoverage(tx *sql.Tx, actionID int64, payload *Payload) error {
+	stmt := tx.Stmt(s.createPackageStmt)
+	for _, pkg := range payload.Packages {
+		_, err := stmt.Exec(actionID,
+			pkg.Package,
+			pkg.Coverage)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   createPackageSQL,
+			}).Info("Sql error")
+			return err
+		}
+	}
+
+	stmt = tx.Stmt(s.createFileStmt)
+	for _, file := range payload.Files {
+		_, err := stmt.Exec(actionID,
+			file.File,
+			file.Statements,
+			file.Covered,
+			file.Coverage)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   createFileSQL,
+			}).Info("Sql error")
+			return err
+		}
+	}
+
+	stmt = tx.Stmt(s.createFuncStmt)
+	for _, fn := range payload.Functions {
+		_, err := stmt.Exec(actionID,
+			fn.File,
+			fn.Line,
+			fn.Function,
+			fn.Coverage)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   createFuncSQL,
+			}).Info("Sql error")
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCoverage selects the file and function coverage stored for an action
+func (s *StatsDB) GetCoverage(actionID int64) *CoverageReport {
+	report := &CoverageReport{Files: []FileCoverage{}, Functions: []FuncCoverage{}}
+
+	rows, err := s.selectFileStmt.Query(actionID)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectFileSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		file := FileCoverage{}
+		err = rows.Scan(&file.File,
+			&file.Statements,
+			&file.Covered,
+			&file.Coverage)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   selectFileSQL,
+			}).Info("Sql error")
+			return nil
+		}
+		report.Files = append(report.Files, file)
+	}
+	if err = rows.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectFileSQL,
+		}).Info("Sql error")
+		return nil
+	}
+
+	funcRows, err := s.selectFuncStmt.Query(actionID)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectFuncSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	defer funcRows.Close()
+	for funcRows.Next() {
+		fn := FuncCoverage{}
+		err = funcRows.Scan(&fn.File,
+			&fn.Line,
+			&fn.Function,
+			&fn.Coverage)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   selectFuncSQL,
+			}).Info("Sql error")
+			return nil
+		}
+		report.Functions = append(report.Functions, fn)
+	}
+	if err = funcRows.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectFuncSQL,
+		}).Info("Sql error")
+		return nil
+	}
+
+	return report
+}
+
+// GetPackageCoverage selects the package coverage stored for an action
+func (s *StatsDB) GetPackageCoverage(actionID int64) []PackageCoverage {
+	rows, err := s.selectPackageStmt.Query(actionID)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectPackageSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	defer rows.Close()
+
+	packages := []PackageCoverage{}
+	for rows.Next() {
+		pkg := PackageCoverage{}
+		if err = rows.Scan(&pkg.Package, &pkg.Coverage); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   selectPackageSQL,
+			}).Info("Sql error")
+			return nil
+		}
+		packages = append(packages, pkg)
+	}
+	if err = rows.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectPackageSQL,
+		}).Info("Sql error")
+		return nil
+	}
+
+	return packages
+}
@@ -0,0 +1,50 @@
+package statsdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestStatsDB_GetCoverage checks if the file and function coverage
+// of an action are stored and retrieved with it
+func TestStatsDB_GetCoverage(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	action := &GitHubAction{
+		Event:   "ringier",
+		Culture: "en_EN",
+		Payload: &Payload{
+			ServiceName: "test",
+			Coverage:    75.0,
+			Files: []FileCoverage{
+				{File: "ringier/pkg/statsdb/sqllite.go", Statements: 4, Covered: 3, Coverage: 75.0},
+			},
+			Functions: []FuncCoverage{
+				{File: "ringier/pkg/statsdb/sqllite.go", Line: 66, Function: "Open", Coverage: 100.0},
+				{File: "ringier/pkg/statsdb/sqllite.go", Line: 81, Function: "Setup", Coverage: 62.5},
+			},
+		},
+	}
+	if err := stats.Save(action); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+
+	want := &CoverageReport{Files: action.Payload.Files, Functions: action.Payload.Functions}
+	got := stats.GetCoverage(action.ID)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StatsDB.GetCoverage(%d): want: %v, got: %v", action.ID, want, got)
+	}
+
+	empty := stats.GetCoverage(action.ID + 1)
+	if empty == nil || len(empty.Files) != 0 || len(empty.Functions) != 0 {
+		t.Errorf("StatsDB.GetCoverage(%d): want: an empty report, got: %v", action.ID+1, empty)
+	}
+}
@@ -0,0 +1,110 @@
+package statsdb
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CoverageDelta structure of the difference between the coverage
+// of a remote action and of the local run it triggered
+type CoverageDelta struct {
+	ActionID       int64    `json:"action_id"`
+	LocalID        int64    `json:"local_id"`
+	RemoteCoverage float64  `json:"remote_coverage"`
+	LocalCoverage  float64  `json:"local_coverage"`
+	Delta          float64  `json:"delta"`
+	RemoteOnly     []string `json:"remote_only,omitempty"`
+	LocalOnly      []string `json:"local_only,omitempty"`
+}
+
+// String formats the delta for the web page
+func (d *CoverageDelta) String() string {
+	if d == nil {
+		return ""
+	}
+	s := fmt.Sprintf("%+.1f (remote %.1f, local %.1f)", d.Delta, d.RemoteCoverage, d.LocalCoverage)
+	if len(d.RemoteOnly) > 0 {
+		s += "; remote only: " + strings.Join(d.RemoteOnly, ", ")
+	}
+	if len(d.LocalOnly) > 0 {
+		s += "; local only: " + strings.Join(d.LocalOnly, ", ")
+	}
+	return s
+}
+
+const (
+	createDeltaSQL = `INSERT INTO coverage_delta (
+	action_id,local_id,remote_coverage,local_coverage,delta,
+	remote_only,local_only)
+	VALUES(?,?,?,?,?,?,?);
+`
+	packageSeparator = "\n"
+)
+
+// SaveDelta inserts a coverage delta into the coverage_delta table
+func (s *StatsDB) SaveDelta(delta *CoverageDelta) error {
+	_, err := s.createDeltaStmt.Exec(delta.ActionID,
+		delta.LocalID,
+		delta.RemoteCoverage,
+		delta.LocalCoverage,
+		delta.Delta,
+		strings.Join(delta.RemoteOnly, packageSeparator),
+		strings.Join(delta.LocalOnly, packageSeparator))
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   createDeltaSQL,
+		}).Info("Sql error")
+		return err
+	}
+	return nil
+}
+
+// deltaColumns structure of the nullable coverage_delta
+// columns joined to an action
+type deltaColumns struct {
+	LocalID        sql.NullInt64
+	RemoteCoverage sql.NullFloat64
+	LocalCoverage  sql.NullFloat64
+	Delta          sql.NullFloat64
+	RemoteOnly     sql.NullString
+	LocalOnly      sql.NullString
+}
+
+// dest returns the scan destinations of the columns
+func (c *deltaColumns) dest() []interface{} {
+	return []interface{}{&c.LocalID,
+		&c.RemoteCoverage,
+		&c.LocalCoverage,
+		&c.Delta,
+		&c.RemoteOnly,
+		&c.LocalOnly}
+}
+
+// delta returns the coverage delta of an action
+// or nil if it has none
+func (c *deltaColumns) delta(actionID int64) *CoverageDelta {
+	if !c.LocalID.Valid {
+		return nil
+	}
+	return &CoverageDelta{
+		ActionID:       actionID,
+		LocalID:        c.LocalID.Int64,
+		RemoteCoverage: c.RemoteCoverage.Float64,
+		LocalCoverage:  c.LocalCoverage.Float64,
+		Delta:          c.Delta.Float64,
+		RemoteOnly:     splitPackages(c.RemoteOnly.String),
+		LocalOnly:      splitPackages(c.LocalOnly.String),
+	}
+}
+
+// splitPackages splits a stored list of packages
+func splitPackages(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, packageSeparator)
+}
@@ -0,0 +1,90 @@
+package statsdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestStatsDB_SaveDelta checks if the coverage delta of a remote
+// action is stored and returned with it
+func TestStatsDB_SaveDelta(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	remote := &GitHubAction{
+		Event:   "TrackTestCoverageEvent",
+		Payload: &Payload{ServiceName: "test", Coverage: 80.0},
+	}
+	if err := stats.Save(remote); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+	local := &GitHubAction{
+		Event:     "ringier",
+		TriggerID: remote.ID,
+		Payload:   &Payload{ServiceName: "test", Coverage: 77.5},
+	}
+	if err := stats.Save(local); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+
+	delta := &CoverageDelta{
+		ActionID:       remote.ID,
+		LocalID:        local.ID,
+		RemoteCoverage: 80.0,
+		LocalCoverage:  77.5,
+		Delta:          -2.5,
+		RemoteOnly:     []string{"ringier/pkg/a", "ringier/pkg/b"},
+	}
+	if err := stats.SaveDelta(delta); err != nil {
+		t.Errorf("StatsDB.SaveDelta(): want: %v, got: %v", nil, err)
+		return
+	}
+
+	all := stats.GetAllActions()
+	if len(all) != 2 {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", 2, len(all))
+		return
+	}
+	if !reflect.DeepEqual(all[0].Delta, delta) {
+		t.Errorf("StatsDB.GetAllActions()[0].Delta: want: %v, got: %v", delta, all[0].Delta)
+	}
+	if all[1].Delta != nil || all[1].TriggerID != remote.ID {
+		t.Errorf("StatsDB.GetAllActions()[1]: want: trigger %v without delta, got: %v %v", remote.ID, all[1].TriggerID, all[1].Delta)
+	}
+}
+
+// TestStatsDB_CoverageDeltaString checks the formatting of a delta
+func TestStatsDB_CoverageDeltaString(t *testing.T) {
+	testCases := []struct {
+		delta *CoverageDelta
+		want  string
+	}{
+		{
+			delta: &CoverageDelta{RemoteCoverage: 80, LocalCoverage: 77.5, Delta: -2.5,
+				RemoteOnly: []string{"a", "b"}, LocalOnly: []string{"c"}},
+			want: "-2.5 (remote 80.0, local 77.5); remote only: a, b; local only: c",
+		},
+		{
+			delta: &CoverageDelta{RemoteCoverage: 70, LocalCoverage: 71, Delta: 1},
+			want:  "+1.0 (remote 70.0, local 71.0)",
+		},
+		{
+			delta: nil,
+			want:  "",
+		},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.delta.String(); got != tc.want {
+			t.Errorf("CoverageDelta.String(): want: %q, got: %q", tc.want, got)
+		}
+	}
+}
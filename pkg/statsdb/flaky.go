@@ -0,0 +1,89 @@
+package statsdb
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// TestOutcome structure of the outcome of a test in a run
+type TestOutcome struct {
+	ActionID    int64  `json:"action_id"`
+	ServiceName string `json:"service_name"`
+	Commit      string `json:"commit"`
+	Package     string `json:"package"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+}
+
+const (
+	outcomeSQL = `SELECT 
+action_id,
+service_name,
+commit_sha,
+package,
+name,
+status
+FROM (
+SELECT 
+test_result.action_id,
+service_name,
+commit_sha,
+package,
+name,
+test_result.status,
+test_result.id,
+row_number() OVER (
+PARTITION BY service_name, package, name
+ORDER BY test_result.action_id DESC, test_result.id DESC
+) AS run
+FROM test_result
+JOIN action ON action.id = test_result.action_id
+WHERE test_result.status IN ('pass', 'fail', 'error')
+AND (? = '' OR service_name = ?)
+) AS outcome
+WHERE run <= ?
+ORDER BY action_id, id;
+`
+)
+
+// GetTestOutcomes selects the outcome of the last window runs of
+// every test which passed or failed, oldest run first.
+// An empty service selects all of them
+func (s *StatsDB) GetTestOutcomes(service string, window int) []TestOutcome {
+	rows, err := s.outcomeStmt.Query(service, service, window)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   outcomeSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	defer rows.Close()
+
+	outcomes := []TestOutcome{}
+	for rows.Next() {
+		outcome := TestOutcome{}
+		err = rows.Scan(&outcome.ActionID,
+			&outcome.ServiceName,
+			&outcome.Commit,
+			&outcome.Package,
+			&outcome.Name,
+			&outcome.Status)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   outcomeSQL,
+			}).Info("Sql error")
+			return nil
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	if err = rows.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   outcomeSQL,
+		}).Info("Sql error")
+		return nil
+	}
+
+	return outcomes
+}
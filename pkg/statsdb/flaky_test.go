@@ -0,0 +1,64 @@
+package statsdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestStatsDB_GetTestOutcomes checks if the outcomes of the tests
+// are selected with the service and the commit of their run
+func TestStatsDB_GetTestOutcomes(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	actions := []*GitHubAction{
+		{Payload: &Payload{ServiceName: "shop", Tests: []TestResult{
+			{Package: "cart", Name: "TestAdd", Status: "pass"},
+			{Package: "cart", Name: "TestSkip", Status: "skip"},
+		}}, Workflow: &WorkflowRun{HeadSHA: "4f2a9c1"}},
+		{Payload: &Payload{ServiceName: "search", Tests: []TestResult{
+			{Package: "query", Name: "TestParse", Status: "fail"},
+		}}},
+		{Payload: &Payload{ServiceName: "search", Tests: []TestResult{
+			{Package: "query", Name: "TestParse", Status: "pass"},
+		}}},
+	}
+	for _, action := range actions {
+		if err := stats.Save(action); err != nil {
+			t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+			return
+		}
+	}
+
+	testCases := []struct {
+		service string
+		window  int
+		want    []TestOutcome
+	}{
+		{service: "", window: 20, want: []TestOutcome{
+			{ActionID: actions[0].ID, ServiceName: "shop", Commit: "4f2a9c1", Package: "cart", Name: "TestAdd", Status: "pass"},
+			{ActionID: actions[1].ID, ServiceName: "search", Package: "query", Name: "TestParse", Status: "fail"},
+			{ActionID: actions[2].ID, ServiceName: "search", Package: "query", Name: "TestParse", Status: "pass"},
+		}},
+		{service: "search", window: 20, want: []TestOutcome{
+			{ActionID: actions[1].ID, ServiceName: "search", Package: "query", Name: "TestParse", Status: "fail"},
+			{ActionID: actions[2].ID, ServiceName: "search", Package: "query", Name: "TestParse", Status: "pass"},
+		}},
+		{service: "", window: 1, want: []TestOutcome{
+			{ActionID: actions[0].ID, ServiceName: "shop", Commit: "4f2a9c1", Package: "cart", Name: "TestAdd", Status: "pass"},
+			{ActionID: actions[2].ID, ServiceName: "search", Package: "query", Name: "TestParse", Status: "pass"},
+		}},
+		{service: "other", window: 20, want: []TestOutcome{}},
+	}
+	for _, tc := range testCases {
+		if got := stats.GetTestOutcomes(tc.service, tc.window); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("StatsDB.GetTestOutcomes(%q, %d): want: %v, got: %v", tc.service, tc.window, tc.want, got)
+		}
+	}
+}
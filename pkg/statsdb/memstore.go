@@ -0,0 +1,606 @@
+package statsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemStore structure of a Store keeping everything in memory,
+// for tests and ephemeral runs. It answers like StatsDB does
+type MemStore struct {
+	mu        sync.Mutex
+	actions   []GitHubAction
+	tests     map[int64][]TestResult
+	files     map[int64][]FileCoverage
+	functions map[int64][]FuncCoverage
+	packages  map[int64][]PackageCoverage
+	suites    map[int64][]TestSuite
+	workflows map[int64]WorkflowRun
+	deltas    map[int64]CoverageDelta
+	verdicts  []Verdict
+	outbox    []OutboxEvent
+	failures  []AuthFailure
+}
+
+// NewMemStore creates an empty in-memory store
+func NewMemStore() *MemStore {
+	return &MemStore{
+		tests:     map[int64][]TestResult{},
+		files:     map[int64][]FileCoverage{},
+		functions: map[int64][]FuncCoverage{},
+		packages:  map[int64][]PackageCoverage{},
+		suites:    map[int64][]TestSuite{},
+		workflows: map[int64]WorkflowRun{},
+		deltas:    map[int64]CoverageDelta{},
+	}
+}
+
+// Setup has nothing to prepare in memory
+func (m *MemStore) Setup() error {
+	return nil
+}
+
+// Save stores a github action together with
+// the results of its tests and its coverage
+func (m *MemStore) Save(action *GitHubAction) error {
+	stampTimes(action)
+	stampSource(action)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := int64(len(m.actions) + 1)
+	stored := *action
+	stored.ID = id
+	stored.Payload = &Payload{
+		ServiceName: action.Payload.ServiceName,
+		Coverage:    action.Payload.Coverage,
+		NoCoverage:  action.Payload.NoCoverage,
+		Status:      action.Payload.Status,
+		ExitCode:    action.Payload.ExitCode,
+		Stderr:      action.Payload.Stderr,
+	}
+	if len(action.Raw) > 0 {
+		stored.Raw = append(json.RawMessage{}, action.Raw...)
+	}
+	stored.Delta = nil
+	stored.Workflow = nil
+	stored.TestSummary = nil
+	m.actions = append(m.actions, stored)
+
+	m.tests[id] = append([]TestResult{}, action.Payload.Tests...)
+	m.files[id] = append([]FileCoverage{}, action.Payload.Files...)
+	m.functions[id] = append([]FuncCoverage{}, action.Payload.Functions...)
+	m.packages[id] = append([]PackageCoverage{}, action.Payload.Packages...)
+	m.suites[id] = append([]TestSuite{}, action.Payload.Suites...)
+	if action.Workflow != nil {
+		run := *action.Workflow
+		run.ActionID = id
+		m.workflows[id] = run
+	}
+	action.ID = id
+	return nil
+}
+
+// action returns a copy of a stored action with
+// its coverage delta, its workflow run and its test summary
+func (m *MemStore) action(i int) GitHubAction {
+	action := m.actions[i]
+	payload := *action.Payload
+	action.Payload = &payload
+	if delta, ok := m.deltas[action.ID]; ok {
+		delta.RemoteOnly = append([]string(nil), delta.RemoteOnly...)
+		delta.LocalOnly = append([]string(nil), delta.LocalOnly...)
+		action.Delta = &delta
+	}
+	if run, ok := m.workflows[action.ID]; ok {
+		action.Workflow = &run
+	}
+	if tests := m.tests[action.ID]; len(tests) > 0 {
+		summary := &TestSummary{Tests: len(tests)}
+		for _, test := range tests {
+			switch test.Status {
+			case "pass":
+				summary.Passed++
+			case "fail", "error":
+				summary.Failed++
+			case "skip":
+				summary.Skipped++
+			}
+			summary.Elapsed += test.Elapsed
+		}
+		action.TestSummary = summary
+	}
+	return action
+}
+
+// GetAllActions returns all stored actions
+func (m *MemStore) GetAllActions() []GitHubAction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	actions := []GitHubAction{}
+	for i := range m.actions {
+		actions = append(actions, m.action(i))
+	}
+	return actions
+}
+
+// matches checks if an action meets the conditions of a filter
+func (f ActionFilter) matches(action *GitHubAction) bool {
+	for _, c := range []struct {
+		value string
+		want  string
+	}{
+		{action.Payload.ServiceName, f.Service},
+		{action.Event, f.Event},
+		{action.VentureReference, f.VentureReference},
+		{action.Version, f.Version},
+		{action.Repository, f.Repository},
+		{action.Branch, f.Branch},
+		{action.CommitSHA, f.CommitSHA},
+		{action.Author, f.Author},
+	} {
+		if c.want != "" && c.value != c.want {
+			return false
+		}
+	}
+	if f.PullRequest != 0 && action.PullRequest != f.PullRequest {
+		return false
+	}
+	for key, value := range f.Payload {
+		if PayloadValue(action.Raw, key) != value {
+			return false
+		}
+	}
+	if !f.From.IsZero() && action.CreatedAt.Unix() < f.From.Unix() {
+		return false
+	}
+	if !f.To.IsZero() && action.CreatedAt.Unix() >= f.To.Unix() {
+		return false
+	}
+	return true
+}
+
+// compareKey compares the sort key and the id of an action
+// to a position, it returns -1, 0 or 1
+func compareKey(sort string, action *GitHubAction, key interface{}, id int64) int {
+	a, b := keyFloat(sortKey(sort, action)), keyFloat(key)
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case action.ID < id:
+		return -1
+	case action.ID > id:
+		return 1
+	}
+	return 0
+}
+
+// keyFloat returns the number of a sort key
+func keyFloat(key interface{}) float64 {
+	switch k := key.(type) {
+	case int64:
+		return float64(k)
+	case float64:
+		return k
+	}
+	return 0
+}
+
+// QueryActions returns the actions matching a filter and
+// the cursor of the next page or an empty string on the last page
+func (m *MemStore) QueryActions(filter ActionFilter) ([]GitHubAction, string, error) {
+	actions := []GitHubAction{}
+	next, err := m.EachAction(filter, func(action *GitHubAction) error {
+		actions = append(actions, *action)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return actions, next, nil
+}
+
+// EachAction passes the actions matching a filter to a function,
+// stopping at the first error of the function.
+// It returns the cursor of the next page or an empty string on the last page
+func (m *MemStore) EachAction(filter ActionFilter, fn func(*GitHubAction) error) (string, error) {
+	if err := filter.Validate(); err != nil {
+		return "", err
+	}
+	order := filter.sortOrder()
+	desc := strings.HasPrefix(order, "-")
+	var cursor *actionCursor
+	if filter.Cursor != "" {
+		cursor, _ = decodeCursor(order, filter.Cursor)
+	}
+
+	m.mu.Lock()
+	actions := []GitHubAction{}
+	for i := range m.actions {
+		action := m.action(i)
+		if !filter.matches(&action) {
+			continue
+		}
+		if cursor != nil {
+			c := compareKey(order, &action, cursor.Key, cursor.ID)
+			if (!desc && c <= 0) || (desc && c >= 0) {
+				continue
+			}
+		}
+		actions = append(actions, action)
+	}
+	m.mu.Unlock()
+	sort.Slice(actions, func(i, j int) bool {
+		c := compareKey(order, &actions[i], sortKey(order, &actions[j]), actions[j].ID)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	for i := range actions {
+		if filter.Limit > 0 && i == filter.Limit {
+			return encodeCursor(order, &actions[i-1]), nil
+		}
+		if err := fn(&actions[i]); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// GetTestResults returns the test results stored for an action
+func (m *MemStore) GetTestResults(actionID int64) []TestResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]TestResult{}, m.tests[actionID]...)
+}
+
+// GetCoverage returns the file and function coverage stored for an action
+func (m *MemStore) GetCoverage(actionID int64) *CoverageReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := &CoverageReport{
+		Files:     append([]FileCoverage{}, m.files[actionID]...),
+		Functions: append([]FuncCoverage{}, m.functions[actionID]...),
+	}
+	sort.SliceStable(report.Files, func(i, j int) bool {
+		return report.Files[i].File < report.Files[j].File
+	})
+	sort.SliceStable(report.Functions, func(i, j int) bool {
+		a, b := report.Functions[i], report.Functions[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return report
+}
+
+// GetPackageCoverage returns the package coverage stored for an action
+func (m *MemStore) GetPackageCoverage(actionID int64) []PackageCoverage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]PackageCoverage{}, m.packages[actionID]...)
+}
+
+// GetTestSuites returns the test suites stored for an action
+func (m *MemStore) GetTestSuites(actionID int64) []TestSuite {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]TestSuite{}, m.suites[actionID]...)
+}
+
+// AddTestReport adds the test suites and the test results
+// of a report to an action already stored
+func (m *MemStore) AddTestReport(actionID int64, suites []TestSuite, tests []TestResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.suites[actionID] = append(m.suites[actionID], suites...)
+	m.tests[actionID] = append(m.tests[actionID], tests...)
+	return nil
+}
+
+// CommitAction returns the id of the last action of a service
+// run for a commit, leaving out the actions of local runs.
+// It returns 0 if there is none
+func (m *MemStore) CommitAction(service, commit string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.actions) - 1; i >= 0; i-- {
+		action := m.actions[i]
+		if action.Payload.ServiceName == service && action.CommitSHA == commit && action.TriggerID == 0 {
+			return action.ID
+		}
+	}
+	return 0
+}
+
+// SaveDelta stores the coverage delta of an action
+func (m *MemStore) SaveDelta(delta *CoverageDelta) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *delta
+	stored.RemoteOnly = append([]string(nil), delta.RemoteOnly...)
+	stored.LocalOnly = append([]string(nil), delta.LocalOnly...)
+	m.deltas[delta.ActionID] = stored
+	return nil
+}
+
+// LastCoverage returns the coverage of the last action received
+// for a service, leaving out the actions of local runs and the
+// actions without coverage. It returns nil if the service has none
+func (m *MemStore) LastCoverage(service string) *Payload {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.actions) - 1; i >= 0; i-- {
+		action := m.actions[i]
+		if action.Payload.ServiceName == service && action.TriggerID == 0 && !action.Payload.NoCoverage {
+			return &Payload{
+				ServiceName: service,
+				Coverage:    action.Payload.Coverage,
+				Packages:    append([]PackageCoverage{}, m.packages[action.ID]...),
+			}
+		}
+	}
+	return nil
+}
+
+// GetTestOutcomes returns the outcome of the last window runs of
+// every test which passed or failed, oldest run first.
+// An empty service selects all of them
+func (m *MemStore) GetTestOutcomes(service string, window int) []TestOutcome {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runs := map[string]int{}
+	outcomes := []TestOutcome{}
+	for i := len(m.actions) - 1; i >= 0; i-- {
+		action := m.actions[i]
+		if service != "" && action.Payload.ServiceName != service {
+			continue
+		}
+		tests := m.tests[action.ID]
+		for j := len(tests) - 1; j >= 0; j-- {
+			test := tests[j]
+			if test.Status != "pass" && test.Status != "fail" && test.Status != "error" {
+				continue
+			}
+			key := action.Payload.ServiceName + "\x00" + test.Package + "\x00" + test.Name
+			if runs[key] >= window {
+				continue
+			}
+			runs[key]++
+			outcomes = append(outcomes, TestOutcome{
+				ActionID:    action.ID,
+				ServiceName: action.Payload.ServiceName,
+				Commit:      action.CommitSHA,
+				Package:     test.Package,
+				Name:        test.Name,
+				Status:      test.Status,
+			})
+		}
+	}
+	for i, j := 0, len(outcomes)-1; i < j; i, j = i+1, j-1 {
+		outcomes[i], outcomes[j] = outcomes[j], outcomes[i]
+	}
+	return outcomes
+}
+
+// bucketTime returns the time bucket of a time
+// formatted like the columns of sqliteBuckets
+func bucketTime(bucket string, t time.Time) string {
+	t = t.UTC()
+	switch bucket {
+	case "hour":
+		return t.Format("2006-01-02T15:00")
+	case "day":
+		return t.Format("2006-01-02")
+	case "week":
+		// the first monday of the year starts week 01
+		monday := (int(t.Weekday()) + 6) % 7
+		return fmt.Sprintf("%d-W%02d", t.Year(), (t.YearDay()+6-monday)/7)
+	}
+	return t.Format("2006-01")
+}
+
+// CoverageTrend aggregates the coverage reported for a service
+// by UTC time bucket of their created_at time. An empty service
+// aggregates every service on its own, a zero from or to
+// leaves the range open. Local runs and actions without coverage
+// are left out
+func (m *MemStore) CoverageTrend(service, bucket string, from, to time.Time) ([]TrendPoint, error) {
+	if _, ok := sqliteBuckets[bucket]; !ok {
+		return nil, ErrBadBucket
+	}
+
+	m.mu.Lock()
+	points := map[[2]string]*TrendPoint{}
+	lastAt := map[[2]string]time.Time{}
+	keys := [][2]string{}
+	for _, action := range m.actions {
+		if action.TriggerID != 0 || action.Payload.NoCoverage ||
+			(service != "" && action.Payload.ServiceName != service) {
+			continue
+		}
+		filter := ActionFilter{From: from, To: to}
+		if !filter.matches(&action) {
+			continue
+		}
+		coverage := action.Payload.Coverage
+		key := [2]string{action.Payload.ServiceName, bucketTime(bucket, action.CreatedAt)}
+		point, ok := points[key]
+		if !ok {
+			point = &TrendPoint{ServiceName: key[0], Bucket: key[1], Min: coverage, Max: coverage}
+			points[key] = point
+			keys = append(keys, key)
+		}
+		point.Min = math.Min(point.Min, coverage)
+		point.Max = math.Max(point.Max, coverage)
+		point.Avg += coverage
+		if !action.CreatedAt.Before(lastAt[key]) {
+			point.Last = coverage
+			lastAt[key] = action.CreatedAt
+		}
+		point.Count++
+	}
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	trend := []TrendPoint{}
+	for _, key := range keys {
+		point := points[key]
+		point.Avg = math.Round(point.Avg/float64(point.Count)*100) / 100
+		trend = append(trend, *point)
+	}
+	return trend, nil
+}
+
+// SaveVerdict stores a verdict
+func (m *MemStore) SaveVerdict(verdict *Verdict) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *verdict
+	stored.Reasons = append([]string{}, verdict.Reasons...)
+	m.verdicts = append(m.verdicts, stored)
+	return nil
+}
+
+// GetVerdict returns the last verdict of a service.
+// It returns nil if the service has none
+func (m *MemStore) GetVerdict(service string) *Verdict {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.verdicts) - 1; i >= 0; i-- {
+		if m.verdicts[i].ServiceName == service {
+			verdict := m.verdicts[i]
+			verdict.Reasons = append([]string{}, verdict.Reasons...)
+			return &verdict
+		}
+	}
+	return nil
+}
+
+// Enqueue adds an event to the outbox to be delivered to a sink
+func (m *MemStore) Enqueue(sink, event string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := int64(len(m.outbox) + 1)
+	m.outbox = append(m.outbox, OutboxEvent{
+		ID:          id,
+		Sink:        sink,
+		Event:       event,
+		Status:      OutboxPending,
+		NextAttempt: time.Unix(time.Now().Unix(), 0),
+	})
+	return id, nil
+}
+
+// UpdateDelivery stores the outcome of a delivery attempt of an event
+func (m *MemStore) UpdateDelivery(event *OutboxEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.outbox {
+		if m.outbox[i].ID == event.ID {
+			stored := *event
+			stored.Sink = m.outbox[i].Sink
+			stored.Event = m.outbox[i].Event
+			stored.NextAttempt = time.Unix(event.NextAttempt.Unix(), 0)
+			m.outbox[i] = stored
+		}
+	}
+	return nil
+}
+
+// Replay puts a dead or failed event back in the outbox for delivery
+func (m *MemStore) Replay(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.outbox {
+		event := &m.outbox[i]
+		if event.ID == id && (event.Status == OutboxDead || event.Status == OutboxFailed) {
+			event.Status = OutboxPending
+			event.Attempts = 0
+			event.NextAttempt = time.Unix(time.Now().Unix(), 0)
+			event.LastError = ""
+			return nil
+		}
+	}
+	return fmt.Errorf("no dead or failed event %d in the outbox", id)
+}
+
+// ClaimEvents claims the pending events of a sink
+// whose next delivery attempt is due until a time
+func (m *MemStore) ClaimEvents(sink string, now, until time.Time, limit int) []OutboxEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := []OutboxEvent{}
+	for i := range m.outbox {
+		if len(events) == limit {
+			break
+		}
+		event := &m.outbox[i]
+		if event.Sink == sink && (event.Status == OutboxPending || event.Status == OutboxSending) &&
+			event.NextAttempt.Unix() <= now.Unix() {
+			event.Status = OutboxSending
+			event.NextAttempt = time.Unix(until.Unix(), 0)
+			events = append(events, *event)
+		}
+	}
+	return events
+}
+
+// GetOutbox returns the events of the outbox with a status
+func (m *MemStore) GetOutbox(status string) []OutboxEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := []OutboxEvent{}
+	for _, event := range m.outbox {
+		if event.Status == status {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// SaveAuthFailure stores a rejected request
+func (m *MemStore) SaveAuthFailure(failure *AuthFailure) error {
+	if failure.CreatedAt.IsZero() {
+		failure.CreatedAt = time.Now()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	failure.ID = 1
+	if len(m.failures) > 0 {
+		failure.ID = m.failures[len(m.failures)-1].ID + 1
+	}
+	stored := *failure
+	stored.CreatedAt = time.Unix(failure.CreatedAt.Unix(), 0)
+	m.failures = append(m.failures, stored)
+	if n := int64(len(m.failures)); n > maxAuthFailures {
+		m.failures = append([]AuthFailure(nil), m.failures[n-maxAuthFailures:]...)
+	}
+	return nil
+}
+
+// GetAuthFailures returns the last rejected requests, newest first
+func (m *MemStore) GetAuthFailures(limit int) []AuthFailure {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	failures := []AuthFailure{}
+	for i := len(m.failures) - 1; i >= 0 && len(failures) < limit; i-- {
+		failures = append(failures, m.failures[i])
+	}
+	return failures
+}
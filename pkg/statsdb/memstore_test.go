@@ -0,0 +1,224 @@
+package statsdb
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// storeActions the actions both stores are filled with
+func storeActions() []*GitHubAction {
+	received := rfc3339("2021-03-05T12:00:00Z")
+	return []*GitHubAction{
+		{
+			Event:      "push",
+			Version:    "1.0.0",
+			CreatedAt:  rfc3339("2021-03-01T08:00:00Z"),
+			ReceivedAt: received,
+			Payload: &Payload{
+				ServiceName: "shop",
+				Coverage:    50,
+				Status:      "pass",
+				Tests: []TestResult{
+					{Package: "shop/cart", Name: "TestAdd", Status: "pass", Elapsed: 0.5},
+					{Package: "shop/cart", Name: "TestRemove", Status: "skip"},
+				},
+				Files: []FileCoverage{
+					{File: "shop/cart/remove.go", Statements: 4, Covered: 1, Coverage: 25},
+					{File: "shop/cart/add.go", Statements: 4, Covered: 3, Coverage: 75},
+				},
+				Functions: []FuncCoverage{
+					{File: "shop/cart/add.go", Line: 20, Function: "Add", Coverage: 75},
+					{File: "shop/cart/add.go", Line: 3, Function: "init", Coverage: 100},
+				},
+				Packages: []PackageCoverage{{Package: "shop/cart", Coverage: 50}},
+				Suites:   []TestSuite{{Name: "cart", Tests: 2, Skipped: 1, Time: 0.5}},
+			},
+			Workflow: &WorkflowRun{RunID: 7, Repository: "ringier/shop", Branch: "main", HeadSHA: "abc"},
+			Raw:      json.RawMessage(`{"runner":"linux","workflow":{"attempt":1}}`),
+			Author:   "Octo Cat",
+		},
+		{
+			Event:      "shop",
+			CreatedAt:  rfc3339("2021-03-01T09:00:00Z"),
+			ReceivedAt: received,
+			TriggerID:  1,
+			Payload: &Payload{
+				ServiceName: "shop",
+				Coverage:    48,
+				Tests:       []TestResult{{Package: "shop/cart", Name: "TestAdd", Status: "fail", Elapsed: 0.25}},
+			},
+		},
+		{
+			Event:       "push",
+			Version:     "1.1.0",
+			CreatedAt:   rfc3339("2021-03-02T10:00:00+02:00"),
+			ReceivedAt:  received,
+			Payload:     &Payload{ServiceName: "search", Coverage: 70},
+			Raw:         json.RawMessage(`{"runner":"macos"}`),
+			Branch:      "feature",
+			PullRequest: 412,
+		},
+		{
+			Event:      "release",
+			Version:    "1.1.0",
+			CreatedAt:  rfc3339("2021-03-08T10:00:00Z"),
+			ReceivedAt: received.Add(time.Hour),
+			Payload: &Payload{
+				ServiceName: "shop",
+				Coverage:    60,
+				Status:      "fail",
+				ExitCode:    1,
+				Stderr:      "FAIL\n",
+				Tests:       []TestResult{{Package: "shop/cart", Name: "TestAdd", Status: "error"}},
+			},
+			Workflow: &WorkflowRun{RunID: 8, Repository: "ringier/shop", Branch: "main", HeadSHA: "def"},
+		},
+		{
+			Event:      "workflow_run",
+			ActionType: "github",
+			CreatedAt:  rfc3339("2021-03-07T10:00:00Z"),
+			ReceivedAt: received.Add(2 * time.Hour),
+			Payload:    &Payload{ServiceName: "shop", Status: "pass", NoCoverage: true},
+			Workflow:   &WorkflowRun{RunID: 9, Repository: "ringier/shop", Branch: "main", HeadSHA: "fed"},
+		},
+	}
+}
+
+// fillStore saves the actions and everything derived from them into a store
+func fillStore(t *testing.T, store Store) {
+	for _, action := range storeActions() {
+		if err := store.Save(action); err != nil {
+			t.Errorf("Store.Save(): want: %v, got: %v", nil, err)
+		}
+	}
+	steps := []error{
+		store.SaveDelta(&CoverageDelta{ActionID: 1, LocalID: 2, RemoteCoverage: 50, LocalCoverage: 48, Delta: -2, LocalOnly: []string{"shop/api"}}),
+		store.AddTestReport(3, []TestSuite{{Name: "search", Tests: 1}}, []TestResult{{Package: "search", Name: "TestFind", Status: "pass", Elapsed: 1}}),
+		store.SaveVerdict(&Verdict{ActionID: 1, ServiceName: "shop", Passed: true}),
+		store.SaveVerdict(&Verdict{ActionID: 4, ServiceName: "shop", Reasons: []string{"coverage dropped"}}),
+		store.SaveAuthFailure(&AuthFailure{Source: "github", Reason: "mismatch", CreatedAt: rfc3339("2021-03-01T08:00:00Z")}),
+		store.SaveAuthFailure(&AuthFailure{Source: "default", Reason: "missing", CreatedAt: rfc3339("2021-03-01T09:00:00Z")}),
+	}
+	for _, sink := range []string{"default", "chat", "default"} {
+		_, err := store.Enqueue(sink, `{"id":1}`)
+		steps = append(steps, err)
+	}
+	steps = append(steps,
+		store.UpdateDelivery(&OutboxEvent{ID: 2, Status: OutboxDead, Attempts: 8, NextAttempt: rfc3339("2021-03-01T08:00:00Z"), LastError: "timeout"}),
+		store.UpdateDelivery(&OutboxEvent{ID: 3, Status: OutboxSent, Attempts: 1, ResponseCode: 200, ResponseBody: "ok"}),
+	)
+	for _, err := range steps {
+		if err != nil {
+			t.Errorf("Store: want: %v, got: %v", nil, err)
+		}
+	}
+}
+
+// allPages reads every page of a filter
+func allPages(store Store, filter ActionFilter) ([]GitHubAction, error) {
+	actions := []GitHubAction{}
+	for {
+		page, next, err := store.QueryActions(filter)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, page...)
+		if next == "" {
+			return actions, nil
+		}
+		filter.Cursor = next
+	}
+}
+
+// TestMemStore checks if the in-memory store answers like the SQLite store
+func TestMemStore(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	if err := stats.Setup(); err != nil {
+		t.Errorf("StatsDB.Setup(): want: %v, got: %v", nil, err)
+		return
+	}
+	mem := NewMemStore()
+	if err := mem.Setup(); err != nil {
+		t.Errorf("MemStore.Setup(): want: %v, got: %v", nil, err)
+		return
+	}
+	fillStore(t, stats)
+	fillStore(t, mem)
+
+	compareStores(t, stats, mem)
+}
+
+// compareStores checks if a store answers like another one
+// after both were filled by fillStore
+func compareStores(t *testing.T, want, got Store) {
+	compare := func(name string, want, got interface{}) {
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%T.%s: want: %+v, got: %+v", got, name, want, got)
+		}
+	}
+
+	compare("GetAllActions()", want.GetAllActions(), got.GetAllActions())
+	for _, filter := range []ActionFilter{
+		{},
+		{Service: "shop", Event: "push"},
+		{Version: "1.1.0", Sort: "-coverage"},
+		{From: rfc3339("2021-03-01T09:00:00Z"), To: rfc3339("2021-03-08T00:00:00Z")},
+		{Sort: "created_at", Limit: 1},
+		{Sort: "-received_at", Limit: 2},
+		{Sort: "-id", Limit: 3},
+		{Sort: "coverage", Limit: 2, Service: "shop"},
+		{Payload: map[string]string{"runner": "linux", "workflow.attempt": "1"}},
+		{Payload: map[string]string{"runner": ""}, Limit: 1},
+		{Repository: "ringier/shop", Branch: "main", Sort: "-created_at"},
+		{CommitSHA: "def"},
+		{PullRequest: 412, Author: ""},
+		{Author: "Octo Cat"},
+	} {
+		wantPages, wantErr := allPages(want, filter)
+		gotPages, gotErr := allPages(got, filter)
+		compare("QueryActions()", wantPages, gotPages)
+		compare("QueryActions() error", wantErr, gotErr)
+	}
+	for _, filter := range []ActionFilter{{Sort: "name"}, {Cursor: "x", Limit: 1}, {Payload: map[string]string{"": "x"}}} {
+		_, _, wantErr := want.QueryActions(filter)
+		_, _, gotErr := got.QueryActions(filter)
+		compare("QueryActions() error", wantErr, gotErr)
+	}
+
+	for id := int64(1); id <= 5; id++ {
+		compare("GetTestResults()", want.GetTestResults(id), got.GetTestResults(id))
+		compare("GetCoverage()", want.GetCoverage(id), got.GetCoverage(id))
+		compare("GetPackageCoverage()", want.GetPackageCoverage(id), got.GetPackageCoverage(id))
+		compare("GetTestSuites()", want.GetTestSuites(id), got.GetTestSuites(id))
+	}
+	for _, commit := range []string{"abc", "def", "xyz"} {
+		compare("CommitAction()", want.CommitAction("shop", commit), got.CommitAction("shop", commit))
+	}
+	for _, service := range []string{"", "shop", "search", "other"} {
+		compare("LastCoverage()", want.LastCoverage(service), got.LastCoverage(service))
+		for _, window := range []int{1, 20} {
+			compare("GetTestOutcomes()", want.GetTestOutcomes(service, window), got.GetTestOutcomes(service, window))
+		}
+		compare("GetVerdict()", want.GetVerdict(service), got.GetVerdict(service))
+		for _, bucket := range []string{"hour", "day", "week", "month", "year"} {
+			wantTrend, wantErr := want.CoverageTrend(service, bucket, time.Time{}, rfc3339("2021-03-08T00:00:00Z"))
+			gotTrend, gotErr := got.CoverageTrend(service, bucket, time.Time{}, rfc3339("2021-03-08T00:00:00Z"))
+			compare("CoverageTrend()", wantTrend, gotTrend)
+			compare("CoverageTrend() error", wantErr, gotErr)
+		}
+	}
+
+	for _, id := range []int64{2, 3, 9} {
+		compare("Replay()", want.Replay(id) == nil, got.Replay(id) == nil)
+	}
+	for _, status := range []string{OutboxPending, OutboxSent, OutboxDead} {
+		compare("GetOutbox()", want.GetOutbox(status), got.GetOutbox(status))
+	}
+	compare("ClaimEvents()", want.ClaimEvents("default", time.Now(), rfc3339("2021-03-08T00:00:00Z"), 1), got.ClaimEvents("default", time.Now(), rfc3339("2021-03-08T00:00:00Z"), 1))
+	compare("GetAuthFailures()", want.GetAuthFailures(1), got.GetAuthFailures(1))
+	compare("GetAuthFailures()", want.GetAuthFailures(10), got.GetAuthFailures(10))
+}
@@ -0,0 +1,588 @@
+package statsdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrBadVersion the schema version to migrate to does not exist
+var ErrBadVersion = errors.New("statsdb: unknown schema version")
+
+// Migration structure of a versioned change of the schema.
+// Up applies the change and Down reverts it, each runs in a transaction
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error
+}
+
+// MigrationStatus structure of a migration and the time it was applied
+type MigrationStatus struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+const (
+	schemaVersionDDLSQL = `create table if not exists schema_version (
+	version INTEGER PRIMARY KEY, name text, applied_at int);
+`
+	selectVersionSQL = `SELECT version, applied_at FROM schema_version;
+`
+	createVersionSQL = `INSERT INTO schema_version (version,name,applied_at)
+	VALUES(?,?,?);
+`
+	deleteVersionSQL = `DELETE FROM schema_version WHERE version = ?;
+`
+
+	// the layouts of the action table, %s is the name of the table
+	actionV1SQL = `create table if not exists %s (id INTEGER PRIMARY KEY ASC,
+	event text,venture_config_id text,venture_reference text,
+	created_at text,culture text,action_type text,
+	action_reference text,version text,route text,
+	service_name text, coverage int);
+`
+	actionV2SQL = `create table if not exists %s (id INTEGER PRIMARY KEY ASC,
+	event text,venture_config_id text,venture_reference text,
+	created_at text,culture text,action_type text,
+	action_reference text,version text,route text,
+	service_name text, coverage int, status text default '',
+	exit_code int default 0, stderr text default '',
+	trigger_id INTEGER default 0);
+`
+	actionV3SQL = `create table if not exists %s (id INTEGER PRIMARY KEY ASC,
+	event text,venture_config_id text,venture_reference text,
+	created_at int,received_at int,culture text,action_type text,
+	action_reference text,version text,route text,
+	service_name text, coverage int, status text default '',
+	exit_code int default 0, stderr text default '',
+	trigger_id INTEGER default 0);
+`
+	actionV4SQL = `create table if not exists %s (id INTEGER PRIMARY KEY ASC,
+	event text,venture_config_id text,venture_reference text,
+	created_at int,received_at int,culture text,action_type text,
+	action_reference text,version text,route text,
+	service_name text, coverage int, status text default '',
+	exit_code int default 0, stderr text default '',
+	trigger_id INTEGER default 0, raw text);
+`
+	actionV1Columns = `id,event,venture_config_id,venture_reference,created_at,
+	culture,action_type,action_reference,version,route,service_name,coverage`
+	actionV2Columns = actionV1Columns + `,status,exit_code,stderr,trigger_id`
+	actionV3Columns = actionV2Columns + `,received_at`
+	actionV4Columns = actionV3Columns + `,raw`
+
+	serviceIndexSQL = `create index if not exists action_service_name on action (service_name);
+`
+	// resultsSQL the tables of the results as the results migration
+	// creates them, later changes to the tables are migrations of their own
+	resultsSQL = `create table if not exists test_result (id INTEGER PRIMARY KEY ASC,
+	action_id INTEGER REFERENCES action(id),package text,name text,
+	status text,elapsed real,output text);
+create table if not exists file_coverage (id INTEGER PRIMARY KEY ASC,
+	action_id INTEGER REFERENCES action(id),file text,
+	statements int,covered int,coverage real);
+create table if not exists func_coverage (id INTEGER PRIMARY KEY ASC,
+	action_id INTEGER REFERENCES action(id),file text,line int,
+	function text,coverage real);
+create table if not exists coverage_delta (id INTEGER PRIMARY KEY ASC,
+	action_id INTEGER REFERENCES action(id),local_id INTEGER REFERENCES action(id),
+	remote_coverage real,local_coverage real,delta real,
+	remote_only text,local_only text);
+create table if not exists package_coverage (id INTEGER PRIMARY KEY ASC,
+	action_id INTEGER REFERENCES action(id),package text,coverage real);
+create table if not exists verdict (id INTEGER PRIMARY KEY ASC,
+	action_id INTEGER REFERENCES action(id),service_name text,
+	passed int,reasons text);
+create table if not exists outbox (id INTEGER PRIMARY KEY ASC,
+	sink text,event text,status text,attempts int,next_attempt int,last_error text,
+	response_code int,response_body text);
+create table if not exists auth_failure (id INTEGER PRIMARY KEY ASC,
+	source text,remote_addr text,signature text,reason text,created_at int);
+create table if not exists workflow_run (id INTEGER PRIMARY KEY ASC,
+	action_id INTEGER REFERENCES action(id),run_id INTEGER,repository text,
+	branch text,head_sha text,workflow text,conclusion text,run_url text);
+create index if not exists workflow_run_head_sha on workflow_run (head_sha);
+create table if not exists test_suite (id INTEGER PRIMARY KEY ASC,
+	action_id INTEGER REFERENCES action(id),name text,tests int,failures int,
+	errors int,skipped int,time real,timestamp text);
+`
+	revertResultsSQL = `drop table if exists test_suite;
+drop table if exists workflow_run;
+drop table if exists auth_failure;
+drop table if exists outbox;
+drop table if exists verdict;
+drop table if exists package_coverage;
+drop table if exists coverage_delta;
+drop table if exists func_coverage;
+drop table if exists file_coverage;
+drop table if exists test_result;
+`
+	timeIndexSQL = `create index if not exists action_created_at on action (created_at);
+create index if not exists action_received_at on action (received_at);
+`
+	sourceIndexSQL = `create index if not exists action_repository on action (repository);
+create index if not exists action_branch on action (branch);
+create index if not exists action_commit_sha on action (commit_sha);
+create index if not exists action_pull_request on action (pull_request);
+create index if not exists action_author on action (author);
+`
+	// actionIndexSQL indexes the action of the rows of the tables
+	// of the results, they are read by action
+	actionIndexSQL = `create index if not exists test_result_action_id on test_result (action_id);
+create index if not exists file_coverage_action_id on file_coverage (action_id);
+create index if not exists func_coverage_action_id on func_coverage (action_id);
+create index if not exists package_coverage_action_id on package_coverage (action_id);
+create index if not exists coverage_delta_action_id on coverage_delta (action_id);
+create index if not exists workflow_run_action_id on workflow_run (action_id);
+create index if not exists test_suite_action_id on test_suite (action_id);
+`
+	revertActionIndexSQL = `drop index if exists test_result_action_id;
+drop index if exists file_coverage_action_id;
+drop index if exists func_coverage_action_id;
+drop index if exists package_coverage_action_id;
+drop index if exists coverage_delta_action_id;
+drop index if exists workflow_run_action_id;
+drop index if exists test_suite_action_id;
+`
+	// sourceFromWorkflowSQL sets the repository, the branch and
+	// the commit of the stored actions from their workflow runs
+	sourceFromWorkflowSQL = `UPDATE action SET
+	repository = coalesce((SELECT repository FROM workflow_run WHERE workflow_run.action_id = action.id), ''),
+	branch = coalesce((SELECT branch FROM workflow_run WHERE workflow_run.action_id = action.id), ''),
+	commit_sha = coalesce((SELECT head_sha FROM workflow_run WHERE workflow_run.action_id = action.id), '')
+	WHERE EXISTS (SELECT 1 FROM workflow_run WHERE workflow_run.action_id = action.id);
+`
+)
+
+// migrations the changes of the schema in the order they are applied.
+// A released migration is never edited, a change of the schema
+// always gets a new migration with the next version
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "action",
+		Up:      execSQL(fmt.Sprintf(actionV1SQL, "action")),
+		Down:    execSQL("drop table if exists action;"),
+	},
+	{
+		Version: 2,
+		Name:    "results",
+		Up:      migrateResults,
+		Down:    revertResults,
+	},
+	{
+		Version: 3,
+		Name:    "action times",
+		Up:      migrateActionTimes,
+		Down:    revertActionTimes,
+	},
+	{
+		Version: 4,
+		Name:    "raw payload",
+		Up:      migrateRawPayload,
+		Down:    revertRawPayload,
+	},
+	{
+		Version: 5,
+		Name:    "source control",
+		Up:      migrateSource,
+		Down:    revertSource,
+	},
+	{
+		Version: 6,
+		Name:    "action id indexes",
+		Up:      execSQL(actionIndexSQL),
+		Down:    execSQL(revertActionIndexSQL),
+	},
+}
+
+// execSQL returns a migration step running statements
+func execSQL(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// columnExists checks if a table has a column
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, kind       string
+			value            sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &kind, &notNull, &value, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// column structure of a column added to a table
+type column struct {
+	name string
+	ddl  string
+}
+
+// addColumns adds the columns a table does not have yet
+func addColumns(tx *sql.Tx, table string, columns []column) error {
+	for _, c := range columns {
+		exists, err := columnExists(tx, table, c.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + c.ddl + ";"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildAction replaces the action table by one created by ddl
+// and filled with the values selected from the old table
+func rebuildAction(tx *sql.Tx, ddl, columns, values string) error {
+	for _, query := range []string{
+		fmt.Sprintf(ddl, "action_new"),
+		fmt.Sprintf("INSERT INTO action_new (%s) SELECT %s FROM action;", columns, values),
+		"DROP TABLE action;",
+		"ALTER TABLE action_new RENAME TO action;",
+		serviceIndexSQL,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateResults adds the outcome of the test command to the action
+// table and creates the tables of the results. Databases set up
+// before the schema was versioned may have some of them already
+func migrateResults(tx *sql.Tx) error {
+	err := addColumns(tx, "action", []column{
+		{"status", "status text default ''"},
+		{"exit_code", "exit_code int default 0"},
+		{"stderr", "stderr text default ''"},
+		{"trigger_id", "trigger_id INTEGER default 0"},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(serviceIndexSQL); err != nil {
+		return err
+	}
+	_, err = tx.Exec(resultsSQL)
+	return err
+}
+
+// revertResults drops the tables of the results and
+// the outcome of the test command from the action table
+func revertResults(tx *sql.Tx) error {
+	if _, err := tx.Exec(revertResultsSQL); err != nil {
+		return err
+	}
+	return rebuildAction(tx, actionV1SQL, actionV1Columns, actionV1Columns)
+}
+
+// migrateActionTimes stores the created_at time as unix time in UTC
+// and adds the received_at time, which is unknown for the stored
+// actions and set to their created_at time
+func migrateActionTimes(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "action", "received_at")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		unix := "coalesce(CAST(strftime('%s', created_at) AS INTEGER), 0)"
+		values := strings.Replace(actionV2Columns, "created_at", unix, 1) + "," + unix
+		if err := rebuildAction(tx, actionV3SQL, actionV3Columns, values); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(timeIndexSQL)
+	return err
+}
+
+// revertActionTimes stores the created_at time as RFC 3339 text
+// and drops the received_at time
+func revertActionTimes(tx *sql.Tx) error {
+	text := "strftime('%Y-%m-%dT%H:%M:%SZ', created_at, 'unixepoch')"
+	values := strings.Replace(actionV2Columns, "created_at", text, 1)
+	return rebuildAction(tx, actionV2SQL, actionV2Columns, values)
+}
+
+// migrateRawPayload adds the raw column keeping the request body
+// of an action, the stored actions have none
+func migrateRawPayload(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "action", "raw")
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec("ALTER TABLE action ADD COLUMN raw text;")
+	return err
+}
+
+// revertRawPayload drops the raw column
+func revertRawPayload(tx *sql.Tx) error {
+	if err := rebuildAction(tx, actionV3SQL, actionV3Columns, actionV3Columns); err != nil {
+		return err
+	}
+	_, err := tx.Exec(timeIndexSQL)
+	return err
+}
+
+// migrateSource adds the repository, the branch, the commit,
+// the pull request and the author of an action. The stored
+// actions get them from their workflow runs when they have one
+func migrateSource(tx *sql.Tx) error {
+	err := addColumns(tx, "action", []column{
+		{"repository", "repository text default ''"},
+		{"branch", "branch text default ''"},
+		{"commit_sha", "commit_sha text default ''"},
+		{"pull_request", "pull_request int default 0"},
+		{"author", "author text default ''"},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(sourceIndexSQL + sourceFromWorkflowSQL)
+	return err
+}
+
+// revertSource drops the repository, the branch, the commit,
+// the pull request and the author of an action
+func revertSource(tx *sql.Tx) error {
+	if err := rebuildAction(tx, actionV4SQL, actionV4Columns, actionV4Columns); err != nil {
+		return err
+	}
+	_, err := tx.Exec(timeIndexSQL)
+	return err
+}
+
+// LatestVersion returns the version of the newest migration
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// migrations returns the migrations of the driver
+func (s *StatsDB) migrations() []Migration {
+	if s.Driver == DriverPostgres {
+		return pgMigrations
+	}
+	return migrations
+}
+
+// appliedVersions returns the applied migrations with the time they were applied
+func (s *StatsDB) appliedVersions() (map[int]time.Time, error) {
+	ddl := schemaVersionDDLSQL
+	if s.Driver == DriverPostgres {
+		ddl = pgSchemaVersionDDLSQL
+	}
+	if _, err := s.DB.Exec(ddl); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   ddl,
+		}).Info("Sql error")
+		return nil, err
+	}
+	rows, err := s.DB.Query(selectVersionSQL)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectVersionSQL,
+		}).Info("Sql error")
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   selectVersionSQL,
+			}).Info("Sql error")
+			return nil, err
+		}
+		applied[version] = time.Unix(appliedAt, 0).UTC()
+	}
+	return applied, rows.Err()
+}
+
+// SchemaVersion returns the version of the newest applied migration,
+// 0 for an empty database
+func (s *StatsDB) SchemaVersion() (int, error) {
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// MigrationStatus lists the migrations and whether they are applied
+func (s *StatsDB) MigrationStatus() ([]MigrationStatus, error) {
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	status := []MigrationStatus{}
+	for _, m := range s.migrations() {
+		appliedAt, ok := applied[m.Version]
+		status = append(status, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return status, nil
+}
+
+// lockMigrations serializes the migrations of the trackers sharing
+// a PostgreSQL database with an advisory lock held by a connection
+// of its own. It returns the function releasing the lock
+func (s *StatsDB) lockMigrations() (func(), error) {
+	if s.Driver != DriverPostgres {
+		return func() {}, nil
+	}
+	ctx := context.Background()
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Sql error")
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, s.rebind(pgLockMigrationsSQL), pgMigrationLock); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   pgLockMigrationsSQL,
+		}).Info("Sql error")
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(ctx, s.rebind(pgUnlockMigrationsSQL), pgMigrationLock); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   pgUnlockMigrationsSQL,
+			}).Info("Sql error")
+		}
+		conn.Close()
+	}, nil
+}
+
+// Migrate applies the pending migrations up to a version
+// and reverts the applied migrations above it. The trackers
+// sharing a PostgreSQL database migrate it one after the other
+func (s *StatsDB) Migrate(version int) error {
+	if version < 0 || version > LatestVersion() {
+		return ErrBadVersion
+	}
+	unlock, err := s.lockMigrations()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return err
+	}
+
+	migrations := s.migrations()
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok || m.Version > version {
+			continue
+		}
+		if err := s.migrate(m, true); err != nil {
+			return err
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok || m.Version <= version {
+			continue
+		}
+		if err := s.migrate(m, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate applies or reverts a migration and records it
+// in the schema_version table in one transaction
+func (s *StatsDB) migrate(m Migration, up bool) error {
+	step, record, args := m.Up, createVersionSQL, []interface{}{m.Version, m.Name, time.Now().Unix()}
+	if !up {
+		step, record, args = m.Down, deleteVersionSQL, []interface{}{m.Version}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Sql error")
+		return err
+	}
+	if err := step(tx); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":     err,
+			"migration": m.Version,
+			"name":      m.Name,
+			"up":        up,
+		}).Info("Migration error")
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(record), args...); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   record,
+		}).Info("Sql error")
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Sql error")
+		return err
+	}
+	logrus.WithFields(logrus.Fields{
+		"migration": m.Version,
+		"name":      m.Name,
+		"up":        up,
+	}).Info("Migration done")
+	return nil
+}
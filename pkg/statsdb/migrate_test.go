@@ -0,0 +1,160 @@
+package statsdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestStatsDB_Migrate checks if the migrations are applied
+// and reverted in order
+func TestStatsDB_Migrate(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+
+	testCases := []struct {
+		version int
+		want    int
+		err     error
+	}{
+		{version: LatestVersion(), want: LatestVersion()},
+		{version: 1, want: 1},
+		{version: 0, want: 0},
+		{version: 2, want: 2},
+		{version: LatestVersion() + 1, want: 2, err: ErrBadVersion},
+		{version: -1, want: 2, err: ErrBadVersion},
+		{version: LatestVersion(), want: LatestVersion()},
+	}
+	for _, tc := range testCases {
+		if err := stats.Migrate(tc.version); err != tc.err {
+			t.Errorf("StatsDB.Migrate(%d): want: %v, got: %v", tc.version, tc.err, err)
+		}
+		got, err := stats.SchemaVersion()
+		if err != nil || got != tc.want {
+			t.Errorf("StatsDB.SchemaVersion() after %d: want: %v, got: %v %v", tc.version, tc.want, got, err)
+		}
+	}
+
+	status, err := stats.MigrationStatus()
+	if err != nil || len(status) != len(migrations) {
+		t.Errorf("StatsDB.MigrationStatus(): want: %v, got: %v %v", len(migrations), len(status), err)
+		return
+	}
+	for _, s := range status {
+		if !s.Applied || s.AppliedAt.IsZero() {
+			t.Errorf("StatsDB.MigrationStatus() %d: want: %v, got: %v", s.Version, true, s)
+		}
+	}
+}
+
+// TestStatsDB_MigrateExisting checks if databases set up before the schema
+// was versioned are migrated without losing their actions
+func TestStatsDB_MigrateExisting(t *testing.T) {
+	testCases := []struct {
+		name   string
+		ddl    string
+		insert string
+		want   time.Time
+	}{
+		{
+			name: "baseline",
+			ddl:  fmt.Sprintf(actionV1SQL, "action"),
+			insert: `INSERT INTO action (event,venture_config_id,venture_reference,created_at,
+	culture,action_type,action_reference,version,route,service_name,coverage)
+	VALUES('push','','','2021-03-02T10:30:00+02:00','en_EN','api','','1.0.0','','test',23.5);`,
+			want: time.Date(2021, 3, 2, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "unversioned",
+			ddl: fmt.Sprintf(actionV3SQL, "action") + serviceIndexSQL + timeIndexSQL + `create table if not exists outbox (id INTEGER PRIMARY KEY ASC,
+	sink text,event text,status text,attempts int,next_attempt int,last_error text,
+	response_code int,response_body text);
+`,
+			insert: `INSERT INTO action (event,venture_config_id,venture_reference,created_at,received_at,
+	culture,action_type,action_reference,version,route,service_name,coverage,status,exit_code,stderr,trigger_id)
+	VALUES('push','','',1614673800,1614673801,'en_EN','api','','1.0.0','','test',23.5,'pass',0,'',0);`,
+			want: time.Date(2021, 3, 2, 8, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range testCases {
+		os.Remove("./test.db")
+		stats := Open("./test.db")
+		if _, err := stats.DB.Exec(tc.ddl + tc.insert); err != nil {
+			t.Errorf("%s: Error creating the database: %v", tc.name, err)
+			continue
+		}
+		if err := stats.Setup(); err != nil {
+			t.Errorf("%s: StatsDB.Setup(): want: %v, got: %v", tc.name, nil, err)
+			continue
+		}
+		all := stats.GetAllActions()
+		if len(all) != 1 {
+			t.Errorf("%s: StatsDB.GetAllActions(): want: %v, got: %v", tc.name, 1, len(all))
+			continue
+		}
+		got := all[0]
+		if !got.CreatedAt.Equal(tc.want) || got.ReceivedAt.Before(tc.want) || got.Payload.Coverage != 23.5 {
+			t.Errorf("%s: StatsDB.GetAllActions(): want: %v, got: %v", tc.name, tc.want, got)
+		}
+
+		if err := stats.Migrate(2); err != nil {
+			t.Errorf("%s: StatsDB.Migrate(%d): want: %v, got: %v", tc.name, 2, nil, err)
+			continue
+		}
+		var createdAt string
+		if err := stats.DB.QueryRow("SELECT created_at FROM action;").Scan(&createdAt); err != nil || createdAt != "2021-03-02T08:30:00Z" {
+			t.Errorf("%s: created_at after StatsDB.Migrate(%d): want: %v, got: %v %v", tc.name, 2, "2021-03-02T08:30:00Z", createdAt, err)
+		}
+		if err := stats.Migrate(LatestVersion()); err != nil {
+			t.Errorf("%s: StatsDB.Migrate(%d): want: %v, got: %v", tc.name, LatestVersion(), nil, err)
+		}
+	}
+}
+
+// TestStatsDB_MigrateSource checks if the stored actions get
+// the repository, the branch and the commit of their workflow runs
+func TestStatsDB_MigrateSource(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	if err := stats.Migrate(4); err != nil {
+		t.Errorf("StatsDB.Migrate(%d): want: %v, got: %v", 4, nil, err)
+		return
+	}
+	if _, err := stats.DB.Exec(`INSERT INTO action (` + actionV3Columns + `)
+	VALUES(1,'push','','',1614673800,'en_EN','api','','1.0.0','','shop',50,'pass',0,'',0,1614673800),
+	(2,'push','','',1614673900,'en_EN','api','','1.0.0','','shop',60,'pass',0,'',0,1614673900);
+INSERT INTO workflow_run (action_id,run_id,repository,branch,head_sha)
+	VALUES(2,7,'ringier/shop','main','abc');`); err != nil {
+		t.Errorf("Error filling the database: %v", err)
+		return
+	}
+	if err := stats.Setup(); err != nil {
+		t.Errorf("StatsDB.Setup(): want: %v, got: %v", nil, err)
+		return
+	}
+
+	all := stats.GetAllActions()
+	if len(all) != 2 {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", 2, len(all))
+		return
+	}
+	if all[0].Repository != "" || all[0].Branch != "" || all[0].CommitSHA != "" {
+		t.Errorf("StatsDB.GetAllActions(): want: no source, got: %v", all[0])
+	}
+	if all[1].Repository != "ringier/shop" || all[1].Branch != "main" || all[1].CommitSHA != "abc" {
+		t.Errorf("StatsDB.GetAllActions(): want: the source of the workflow run, got: %v", all[1])
+	}
+	if id := stats.CommitAction("shop", "abc"); id != 2 {
+		t.Errorf("StatsDB.CommitAction(): want: %v, got: %v", 2, id)
+	}
+
+	if err := stats.Migrate(4); err != nil {
+		t.Errorf("StatsDB.Migrate(%d): want: %v, got: %v", 4, nil, err)
+	}
+	if exists, err := stats.DB.Query("SELECT commit_sha FROM action;"); err == nil {
+		exists.Close()
+		t.Errorf("StatsDB.Migrate(%d): want: no commit_sha column, got: %v", 4, err)
+	}
+}
@@ -0,0 +1,222 @@
+package statsdb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OutboxPending status of an event waiting for its delivery
+	OutboxPending = "pending"
+	// OutboxSent status of a delivered event
+	OutboxSent = "sent"
+	// OutboxDead status of an event which ran out of delivery attempts
+	OutboxDead = "dead"
+	// OutboxFailed status of an event refused by its destination
+	OutboxFailed = "failed"
+	// OutboxSending status of an event claimed for its delivery,
+	// its next attempt is the end of the claim
+	OutboxSending = "sending"
+)
+
+// OutboxEvent structure of an event to be delivered
+type OutboxEvent struct {
+	ID           int64     `json:"id"`
+	Sink         string    `json:"sink"`
+	Event        string    `json:"event"`
+	Status       string    `json:"status"`
+	Attempts     int       `json:"attempts"`
+	NextAttempt  time.Time `json:"next_attempt"`
+	LastError    string    `json:"last_error,omitempty"`
+	ResponseCode int       `json:"response_code,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+}
+
+const (
+	createOutboxSQL = `INSERT INTO outbox (
+	sink,event,status,attempts,next_attempt,last_error,
+	response_code,response_body)
+	VALUES(?,?,?,0,?,'',0,'');
+`
+	updateOutboxSQL = `UPDATE outbox SET
+	status = ?,attempts = ?,next_attempt = ?,last_error = ?,
+	response_code = ?,response_body = ?
+	WHERE id = ?;
+`
+	replayOutboxSQL = `UPDATE outbox SET
+	status = ?,attempts = 0,next_attempt = ?,last_error = ''
+	WHERE id = ? AND status IN (?, ?);
+`
+	dueOutboxSQL = `SELECT 
+id,
+sink,
+event,
+status,
+attempts,
+next_attempt,
+last_error,
+response_code,
+response_body
+FROM outbox
+WHERE sink = ? AND status IN (?, ?) AND next_attempt <= ?
+ORDER BY id
+LIMIT ?;
+`
+	claimOutboxSQL = `UPDATE outbox SET
+	status = ?,next_attempt = ?
+	WHERE id = ? AND status = ? AND next_attempt = ?;
+`
+	selectOutboxSQL = `SELECT 
+id,
+sink,
+event,
+status,
+attempts,
+next_attempt,
+last_error,
+response_code,
+response_body
+FROM outbox
+WHERE status = ?
+ORDER BY id;
+`
+)
+
+// Enqueue inserts an event into the outbox to be delivered to a sink
+func (s *StatsDB) Enqueue(sink, event string) (int64, error) {
+	id, err := s.insert(s.createOutboxStmt, sink, event, OutboxPending, time.Now().Unix())
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   createOutboxSQL,
+		}).Info("Sql error")
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateDelivery stores the outcome of a delivery attempt of an event
+func (s *StatsDB) UpdateDelivery(event *OutboxEvent) error {
+	_, err := s.updateOutboxStmt.Exec(event.Status,
+		event.Attempts,
+		event.NextAttempt.Unix(),
+		event.LastError,
+		event.ResponseCode,
+		event.ResponseBody,
+		event.ID)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   updateOutboxSQL,
+		}).Info("Sql error")
+		return err
+	}
+	return nil
+}
+
+// Replay puts a dead or failed event back in the outbox for delivery
+func (s *StatsDB) Replay(id int64) error {
+	res, err := s.replayOutboxStmt.Exec(OutboxPending, time.Now().Unix(), id, OutboxDead, OutboxFailed)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   replayOutboxSQL,
+		}).Info("Sql error")
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("no dead or failed event %d in the outbox", id)
+	}
+	return nil
+}
+
+// ClaimEvents claims the pending events of a sink whose next
+// delivery attempt is due until a time. Every event is claimed
+// only if it is unchanged since it was selected, the trackers
+// sharing the database skip the events another one claimed.
+// An event whose claim ran out is due again
+func (s *StatsDB) ClaimEvents(sink string, now, until time.Time, limit int) []OutboxEvent {
+	rows, err := s.dueOutboxStmt.Query(sink, OutboxPending, OutboxSending, now.Unix(), limit)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   dueOutboxSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	due := scanOutbox(rows, dueOutboxSQL)
+
+	events := []OutboxEvent{}
+	for _, event := range due {
+		res, err := s.claimOutboxStmt.Exec(OutboxSending, until.Unix(),
+			event.ID, event.Status, event.NextAttempt.Unix())
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   claimOutboxSQL,
+			}).Info("Sql error")
+			return events
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		event.Status = OutboxSending
+		event.NextAttempt = time.Unix(until.Unix(), 0)
+		events = append(events, event)
+	}
+	return events
+}
+
+// GetOutbox selects the events of the outbox with a status
+func (s *StatsDB) GetOutbox(status string) []OutboxEvent {
+	rows, err := s.selectOutboxStmt.Query(status)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectOutboxSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	return scanOutbox(rows, selectOutboxSQL)
+}
+
+// scanOutbox reads the outbox events of a query
+func scanOutbox(rows *sql.Rows, query string) []OutboxEvent {
+	defer rows.Close()
+
+	events := []OutboxEvent{}
+	for rows.Next() {
+		event := OutboxEvent{}
+		var nextAttempt int64
+		err := rows.Scan(&event.ID,
+			&event.Sink,
+			&event.Event,
+			&event.Status,
+			&event.Attempts,
+			&nextAttempt,
+			&event.LastError,
+			&event.ResponseCode,
+			&event.ResponseBody)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   query,
+			}).Info("Sql error")
+			return nil
+		}
+		event.NextAttempt = time.Unix(nextAttempt, 0)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   query,
+		}).Info("Sql error")
+		return nil
+	}
+
+	return events
+}
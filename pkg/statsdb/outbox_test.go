@@ -0,0 +1,106 @@
+package statsdb
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// TestStatsDB_Outbox checks if events go through the outbox
+// from pending to dead and back with a replay
+func TestStatsDB_Outbox(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	id, err := stats.Enqueue("default", `{"event":"test"}`)
+	if err != nil {
+		t.Errorf("StatsDB.Enqueue(): want: %v, got: %v", nil, err)
+		return
+	}
+
+	until := time.Now().Add(time.Minute)
+	if other := stats.ClaimEvents("other", time.Now(), until, 10); len(other) != 0 {
+		t.Errorf("StatsDB.ClaimEvents(%q): want: %v events, got: %v", "other", 0, len(other))
+	}
+	due := stats.ClaimEvents("default", time.Now(), until, 10)
+	if len(due) != 1 || due[0].ID != id || due[0].Sink != "default" || due[0].Event != `{"event":"test"}` ||
+		due[0].Status != OutboxSending {
+		t.Errorf("StatsDB.ClaimEvents(): want: event %v, got: %v", id, due)
+		return
+	}
+
+	event := due[0]
+	event.Status = OutboxPending
+	event.Attempts = 1
+	event.LastError = "connection refused"
+	event.NextAttempt = time.Now().Add(time.Hour)
+	if err := stats.UpdateDelivery(&event); err != nil {
+		t.Errorf("StatsDB.UpdateDelivery(): want: %v, got: %v", nil, err)
+	}
+	if due := stats.ClaimEvents("default", time.Now(), until, 10); len(due) != 0 {
+		t.Errorf("StatsDB.ClaimEvents(): want: %v events, got: %v", 0, len(due))
+	}
+	if err := stats.Replay(id); err == nil {
+		t.Errorf("StatsDB.Replay(%d): want: an error for a pending event, got: %v", id, err)
+	}
+
+	event.Status = OutboxDead
+	if err := stats.UpdateDelivery(&event); err != nil {
+		t.Errorf("StatsDB.UpdateDelivery(): want: %v, got: %v", nil, err)
+	}
+	dead := stats.GetOutbox(OutboxDead)
+	if len(dead) != 1 || dead[0].Attempts != 1 || dead[0].LastError != "connection refused" {
+		t.Errorf("StatsDB.GetOutbox(%q): want: event %v, got: %v", OutboxDead, id, dead)
+	}
+
+	if err := stats.Replay(id); err != nil {
+		t.Errorf("StatsDB.Replay(%d): want: %v, got: %v", id, nil, err)
+	}
+	due = stats.ClaimEvents("default", time.Now(), until, 10)
+	if len(due) != 1 || due[0].Attempts != 0 || due[0].Status != OutboxSending {
+		t.Errorf("StatsDB.ClaimEvents(): want: replayed event %v, got: %v", id, due)
+	}
+}
+
+// TestStatsDB_ClaimEvents checks if two trackers sharing a database
+// deliver every event once, and again when its claim ran out
+func TestStatsDB_ClaimEvents(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+	other := Open("./test.db")
+	if err := other.Setup(); err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := stats.Enqueue("default", `{"event":"test"}`); err != nil {
+			t.Errorf("StatsDB.Enqueue(): want: %v, got: %v", nil, err)
+			return
+		}
+	}
+
+	now := time.Now()
+	until := now.Add(time.Minute)
+	first := stats.ClaimEvents("default", now, until, 2)
+	second := other.ClaimEvents("default", now, until, 10)
+	if len(first) != 2 || len(second) != 1 || second[0].ID == first[0].ID || second[0].ID == first[1].ID {
+		t.Errorf("StatsDB.ClaimEvents(): want: %v and %v events, got: %v and %v", 2, 1, first, second)
+	}
+	if again := other.ClaimEvents("default", now, until, 10); len(again) != 0 {
+		t.Errorf("StatsDB.ClaimEvents(claimed): want: %v events, got: %v", 0, again)
+	}
+	if expired := other.ClaimEvents("default", until, until.Add(time.Minute), 10); len(expired) != 3 {
+		t.Errorf("StatsDB.ClaimEvents(expired): want: %v events, got: %v", 3, expired)
+	}
+}
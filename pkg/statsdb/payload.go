@@ -0,0 +1,101 @@
+package statsdb
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrBadPayloadKey the payload key of a filter is not a dot
+// separated path of letters, digits, underscores and dashes
+var ErrBadPayloadKey = errors.New("statsdb: bad payload key")
+
+// sqliteDriver the sqlite 3 driver with the payload_value function,
+// the raw payloads are queried with it
+const sqliteDriver = "sqlite3_tracker"
+
+// init registers the sqlite 3 driver of the tracker
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("payload_value", sqlitePayloadValue, true)
+		},
+	})
+}
+
+// payloadPath splits a payload key like workflow.branch into its fields
+func payloadPath(key string) ([]string, error) {
+	path := strings.Split(key, ".")
+	for _, field := range path {
+		if field == "" {
+			return nil, ErrBadPayloadKey
+		}
+		for _, r := range field {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+				return nil, ErrBadPayloadKey
+			}
+		}
+	}
+	return path, nil
+}
+
+// ValidatePayloadKey checks if a payload key can be read
+func ValidatePayloadKey(key string) error {
+	_, err := payloadPath(key)
+	return err
+}
+
+// PayloadValue returns the value of a key of a raw payload as text:
+// a string as it is, any other value as its JSON. A missing key,
+// a null and a payload which is not a JSON object read as empty
+func PayloadValue(raw []byte, key string) string {
+	path, err := payloadPath(key)
+	if err != nil {
+		return ""
+	}
+	value := json.RawMessage(raw)
+	for _, field := range path {
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(value, &object); err != nil {
+			return ""
+		}
+		if value = object[field]; value == nil {
+			return ""
+		}
+	}
+	value = bytes.TrimSpace(value)
+	switch {
+	case bytes.Equal(value, []byte("null")):
+		return ""
+	case bytes.HasPrefix(value, []byte(`"`)):
+		s := ""
+		json.Unmarshal(value, &s)
+		return s
+	}
+	return string(value)
+}
+
+// sqlitePayloadValue the payload_value function of sqlite,
+// the raw column of an action without payload is null
+func sqlitePayloadValue(raw interface{}, key string) string {
+	switch value := raw.(type) {
+	case string:
+		return PayloadValue([]byte(value), key)
+	case []byte:
+		return PayloadValue(value, key)
+	}
+	return ""
+}
+
+// rawValue returns the value a raw payload is stored with,
+// null for an action without payload
+func rawValue(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -0,0 +1,116 @@
+package statsdb
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestPayloadValue(t *testing.T) {
+	raw := []byte(`{"runner":"linux","attempt":2,"rerun":false,"commit":null,
+	"workflow":{"branch":"main","jobs":["test"]}}`)
+	testCases := []struct {
+		raw  []byte
+		key  string
+		want string
+	}{
+		{raw: raw, key: "runner", want: "linux"},
+		{raw: raw, key: "attempt", want: "2"},
+		{raw: raw, key: "rerun", want: "false"},
+		{raw: raw, key: "commit", want: ""},
+		{raw: raw, key: "workflow.branch", want: "main"},
+		{raw: raw, key: "workflow.jobs", want: `["test"]`},
+		{raw: raw, key: "workflow.branch.name", want: ""},
+		{raw: raw, key: "missing", want: ""},
+		{raw: raw, key: "workflow..branch", want: ""},
+		{raw: nil, key: "runner", want: ""},
+		{raw: []byte(`["linux"]`), key: "runner", want: ""},
+	}
+	for _, tc := range testCases {
+		if got := PayloadValue(tc.raw, tc.key); got != tc.want {
+			t.Errorf("PayloadValue(%q): want: %q, got: %q", tc.key, tc.want, got)
+		}
+	}
+}
+
+func TestValidatePayloadKey(t *testing.T) {
+	testCases := []struct {
+		key  string
+		want error
+	}{
+		{key: "runner", want: nil},
+		{key: "workflow.head-branch_2", want: nil},
+		{key: "", want: ErrBadPayloadKey},
+		{key: "workflow.", want: ErrBadPayloadKey},
+		{key: "runner') OR 1=1", want: ErrBadPayloadKey},
+	}
+	for _, tc := range testCases {
+		if got := ValidatePayloadKey(tc.key); got != tc.want {
+			t.Errorf("ValidatePayloadKey(%q): want: %v, got: %v", tc.key, tc.want, got)
+		}
+	}
+}
+
+// TestStatsDB_QueryPayload checks if the raw payload is stored
+// verbatim and if the actions are selected by its keys
+func TestStatsDB_QueryPayload(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	if err := stats.Setup(); err != nil {
+		t.Errorf("StatsDB.Setup(): want: %v, got: %v", nil, err)
+		return
+	}
+	raws := []json.RawMessage{
+		json.RawMessage(`{"runner": "linux", "workflow": {"branch": "main"}, "attempt": 1}`),
+		json.RawMessage(`{"runner": "macos", "workflow": {"branch": "main"}}`),
+		nil,
+	}
+	for _, raw := range raws {
+		if err := stats.Save(&GitHubAction{Event: "push", Payload: &Payload{ServiceName: "shop"}, Raw: raw}); err != nil {
+			t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+			return
+		}
+	}
+
+	actions := stats.GetAllActions()
+	if len(actions) != len(raws) {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", len(raws), len(actions))
+		return
+	}
+	for i, action := range actions {
+		if !reflect.DeepEqual(action.Raw, raws[i]) {
+			t.Errorf("StatsDB.GetAllActions() raw: want: %s, got: %s", raws[i], action.Raw)
+		}
+	}
+
+	testCases := []struct {
+		payload map[string]string
+		want    []int64
+		err     error
+	}{
+		{payload: map[string]string{"workflow.branch": "main"}, want: []int64{1, 2}},
+		{payload: map[string]string{"workflow.branch": "main", "runner": "macos"}, want: []int64{2}},
+		{payload: map[string]string{"attempt": "1"}, want: []int64{1}},
+		{payload: map[string]string{"runner": ""}, want: []int64{3}},
+		{payload: map[string]string{"runner": "windows"}, want: []int64{}},
+		{payload: map[string]string{"runner;": "linux"}, err: ErrBadPayloadKey},
+	}
+	for _, tc := range testCases {
+		actions, _, err := stats.QueryActions(ActionFilter{Payload: tc.payload})
+		if err != tc.err {
+			t.Errorf("StatsDB.QueryActions(%v): want: %v, got: %v", tc.payload, tc.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got := []int64{}
+		for _, action := range actions {
+			got = append(got, action.ID)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("StatsDB.QueryActions(%v): want: %v, got: %v", tc.payload, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package statsdb
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// DriverPostgres driver of a PostgreSQL database, shared by several trackers
+const DriverPostgres = "postgres"
+
+// pgMigrationLock the key of the advisory lock the trackers sharing
+// a PostgreSQL database take to apply or revert the migrations
+const pgMigrationLock = 5146871
+
+const (
+	pgLockMigrationsSQL   = `SELECT pg_advisory_lock(?);`
+	pgUnlockMigrationsSQL = `SELECT pg_advisory_unlock(?);`
+	pgSchemaVersionDDLSQL = `create table if not exists schema_version (
+	version INTEGER PRIMARY KEY, name text, applied_at bigint);
+`
+	pgActionSQL = `create table if not exists action (id BIGSERIAL PRIMARY KEY,
+	event text,venture_config_id text,venture_reference text,
+	created_at text,culture text,action_type text,
+	action_reference text,version text,route text,
+	service_name text, coverage double precision);
+`
+	pgResultsSQL = `alter table action add column if not exists status text default '',
+	add column if not exists exit_code int default 0,
+	add column if not exists stderr text default '',
+	add column if not exists trigger_id bigint default 0;
+create index if not exists action_service_name on action (service_name);
+create table if not exists test_result (id BIGSERIAL PRIMARY KEY,
+	action_id bigint REFERENCES action(id),package text,name text,
+	status text,elapsed double precision,output text);
+create table if not exists file_coverage (id BIGSERIAL PRIMARY KEY,
+	action_id bigint REFERENCES action(id),file text,
+	statements int,covered int,coverage double precision);
+create table if not exists func_coverage (id BIGSERIAL PRIMARY KEY,
+	action_id bigint REFERENCES action(id),file text,line int,
+	function text,coverage double precision);
+create table if not exists coverage_delta (id BIGSERIAL PRIMARY KEY,
+	action_id bigint REFERENCES action(id),local_id bigint REFERENCES action(id),
+	remote_coverage double precision,local_coverage double precision,delta double precision,
+	remote_only text,local_only text);
+create table if not exists package_coverage (id BIGSERIAL PRIMARY KEY,
+	action_id bigint REFERENCES action(id),package text,coverage double precision);
+create table if not exists verdict (id BIGSERIAL PRIMARY KEY,
+	action_id bigint REFERENCES action(id),service_name text,
+	passed boolean,reasons text);
+create table if not exists outbox (id BIGSERIAL PRIMARY KEY,
+	sink text,event text,status text,attempts int,next_attempt bigint,last_error text,
+	response_code int,response_body text);
+create table if not exists auth_failure (id BIGSERIAL PRIMARY KEY,
+	source text,remote_addr text,signature text,reason text,created_at bigint);
+create table if not exists workflow_run (id BIGSERIAL PRIMARY KEY,
+	action_id bigint REFERENCES action(id),run_id bigint,repository text,
+	branch text,head_sha text,workflow text,conclusion text,run_url text);
+create index if not exists workflow_run_head_sha on workflow_run (head_sha);
+create table if not exists test_suite (id BIGSERIAL PRIMARY KEY,
+	action_id bigint REFERENCES action(id),name text,tests int,failures int,
+	errors int,skipped int,time double precision,timestamp text);
+`
+	pgRevertResultsSQL = `drop table if exists test_suite, workflow_run, auth_failure,
+	outbox, verdict, package_coverage, coverage_delta, func_coverage,
+	file_coverage, test_result;
+drop index if exists action_service_name;
+alter table action drop column status, drop column exit_code,
+	drop column stderr, drop column trigger_id;
+`
+	pgActionTimesSQL = `alter table action
+	alter column created_at type bigint
+	using coalesce(extract(epoch from nullif(created_at, '')::timestamptz)::bigint, 0),
+	add column if not exists received_at bigint;
+update action set received_at = created_at where received_at is null;
+create index if not exists action_created_at on action (created_at);
+create index if not exists action_received_at on action (received_at);
+`
+	pgRevertActionTimesSQL = `drop index if exists action_created_at;
+drop index if exists action_received_at;
+alter table action drop column received_at,
+	alter column created_at type text
+	using to_char(to_timestamp(created_at) at time zone 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"');
+`
+	pgRawPayloadSQL = `alter table action add column if not exists raw json;
+`
+	pgSourceSQL = `alter table action add column if not exists repository text default '',
+	add column if not exists branch text default '',
+	add column if not exists commit_sha text default '',
+	add column if not exists pull_request int default 0,
+	add column if not exists author text default '';
+` + sourceIndexSQL + sourceFromWorkflowSQL
+	pgRevertSourceSQL = `alter table action drop column repository, drop column branch,
+	drop column commit_sha, drop column pull_request, drop column author;
+`
+	// pgBucketTime the created_at time of an action in UTC
+	pgBucketTime = "(to_timestamp(created_at) at time zone 'UTC')"
+)
+
+// pgMigrations the migrations of a PostgreSQL database, they have
+// the versions and the names of the SQLite migrations
+var pgMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "action",
+		Up:      execSQL(pgActionSQL),
+		Down:    execSQL("drop table if exists action;"),
+	},
+	{
+		Version: 2,
+		Name:    "results",
+		Up:      execSQL(pgResultsSQL),
+		Down:    execSQL(pgRevertResultsSQL),
+	},
+	{
+		Version: 3,
+		Name:    "action times",
+		Up:      execSQL(pgActionTimesSQL),
+		Down:    execSQL(pgRevertActionTimesSQL),
+	},
+	{
+		Version: 4,
+		Name:    "raw payload",
+		Up:      execSQL(pgRawPayloadSQL),
+		Down:    execSQL("alter table action drop column raw;"),
+	},
+	{
+		Version: 5,
+		Name:    "source control",
+		Up:      execSQL(pgSourceSQL),
+		Down:    execSQL(pgRevertSourceSQL),
+	},
+	{
+		Version: 6,
+		Name:    "action id indexes",
+		Up:      execSQL(actionIndexSQL),
+		Down:    execSQL(revertActionIndexSQL),
+	},
+}
+
+// pgBuckets the columns of the time buckets of a trend in PostgreSQL.
+// A week starts on monday, the first monday of the year starts week 01
+var pgBuckets = map[string]string{
+	"hour": "to_char(" + pgBucketTime + `, 'YYYY-MM-DD"T"HH24:00')`,
+	"day":  "to_char(" + pgBucketTime + ", 'YYYY-MM-DD')",
+	"week": "to_char(" + pgBucketTime + ", 'YYYY') || '-W' || " +
+		"lpad(((extract(doy from " + pgBucketTime + ")::int + 7 - extract(isodow from " +
+		pgBucketTime + ")::int) / 7)::text, 2, '0')",
+	"month": "to_char(" + pgBucketTime + ", 'YYYY-MM')",
+}
+
+// rebind replaces the ? placeholders of a query by the numbered
+// placeholders of PostgreSQL, leaving quoted strings alone
+func rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// returningID makes an insert statement return the id of the new row
+func returningID(query string) string {
+	return strings.TrimRight(query, ";\n") + " RETURNING id;\n"
+}
+
+// insert runs an insert statement and returns the id of the new row
+func (s *StatsDB) insert(stmt *sql.Stmt, args ...interface{}) (int64, error) {
+	if s.Driver == DriverPostgres {
+		var id int64
+		err := stmt.QueryRow(args...).Scan(&id)
+		return id, err
+	}
+	res, err := stmt.Exec(args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
@@ -0,0 +1,103 @@
+package statsdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	testCases := []struct {
+		query string
+		want  string
+	}{
+		{query: "SELECT id FROM action;", want: "SELECT id FROM action;"},
+		{query: "SELECT id FROM action WHERE id = ? AND service_name = ?", want: "SELECT id FROM action WHERE id = $1 AND service_name = $2"},
+		{query: "SELECT '?' AS q FROM action WHERE id = ?", want: "SELECT '?' AS q FROM action WHERE id = $1"},
+	}
+	for _, tc := range testCases {
+		if got := rebind(tc.query); got != tc.want {
+			t.Errorf("rebind(%q): want: %v, got: %v", tc.query, tc.want, got)
+		}
+	}
+}
+
+func TestReturningID(t *testing.T) {
+	want := "INSERT INTO outbox (sink) VALUES(?) RETURNING id;\n"
+	if got := returningID("INSERT INTO outbox (sink) VALUES(?);\n"); got != want {
+		t.Errorf("returningID(): want: %q, got: %q", want, got)
+	}
+}
+
+// TestPgMigrations checks if the PostgreSQL migrations
+// follow the SQLite migrations
+func TestPgMigrations(t *testing.T) {
+	if len(pgMigrations) != len(migrations) {
+		t.Errorf("pgMigrations: want: %v, got: %v", len(migrations), len(pgMigrations))
+		return
+	}
+	for i, m := range migrations {
+		if pgMigrations[i].Version != m.Version || pgMigrations[i].Name != m.Name {
+			t.Errorf("pgMigrations[%d]: want: %d %s, got: %d %s", i,
+				m.Version, m.Name, pgMigrations[i].Version, pgMigrations[i].Name)
+		}
+	}
+	for bucket := range sqliteBuckets {
+		if _, ok := pgBuckets[bucket]; !ok {
+			t.Errorf("pgBuckets[%q]: want: %v, got: %v", bucket, true, ok)
+		}
+	}
+}
+
+// TestPostgres checks if the PostgreSQL store answers like the in-memory
+// store. It runs against the database of TRACKER_POSTGRES_DSN, whose
+// schema it drops and recreates
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("TRACKER_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TRACKER_POSTGRES_DSN is not set")
+	}
+	pg := OpenDriver(DriverPostgres, dsn)
+	if pg == nil {
+		t.Errorf("OpenDriver(): want: a database, got: %v", pg)
+		return
+	}
+	defer pg.DB.Close()
+
+	for _, version := range []int{0, LatestVersion(), 1, 0} {
+		if err := pg.Migrate(version); err != nil {
+			t.Errorf("StatsDB.Migrate(%d): want: %v, got: %v", version, nil, err)
+			return
+		}
+		if got, err := pg.SchemaVersion(); err != nil || got != version {
+			t.Errorf("StatsDB.SchemaVersion(): want: %v, got: %v %v", version, got, err)
+		}
+	}
+
+	// trackers starting together migrate the database one after the other
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			replica := OpenDriver(DriverPostgres, dsn)
+			defer replica.DB.Close()
+			errs <- replica.Migrate(LatestVersion())
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("StatsDB.Migrate(%d): want: %v, got: %v", LatestVersion(), nil, err)
+		}
+	}
+	if err := pg.Setup(); err != nil {
+		t.Errorf("StatsDB.Setup(): want: %v, got: %v", nil, err)
+		return
+	}
+	mem := NewMemStore()
+	if err := mem.Setup(); err != nil {
+		t.Errorf("MemStore.Setup(): want: %v, got: %v", nil, err)
+		return
+	}
+	fillStore(t, pg)
+	fillStore(t, mem)
+
+	compareStores(t, mem, pg)
+}
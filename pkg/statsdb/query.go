@@ -0,0 +1,295 @@
+package statsdb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// eachActionPage the number of actions EachAction reads at once
+const eachActionPage = 500
+
+var (
+	// ErrBadSort the sort order of a filter is not supported
+	ErrBadSort = errors.New("statsdb: unknown sort order")
+	// ErrBadCursor the cursor of a filter cannot be read
+	// or was made for another sort order
+	ErrBadCursor = errors.New("statsdb: bad cursor")
+)
+
+// sortColumns the columns the actions can be sorted by,
+// a sort order prefixed by a minus sorts in descending order
+var sortColumns = map[string]string{
+	"id":          "action.id",
+	"created_at":  "action.created_at",
+	"received_at": "action.received_at",
+	"coverage":    "coalesce(action.coverage, 0)",
+}
+
+// ActionFilter structure of the conditions selecting actions.
+// Empty fields select everything, From is inclusive and To exclusive
+// on the created_at time. Payload selects the actions whose raw
+// payload has the values of its keys, read by PayloadValue.
+// With a Limit the actions are returned by pages, the cursor
+// of the next page is returned with every page
+type ActionFilter struct {
+	Service          string
+	Event            string
+	VentureReference string
+	Version          string
+	Repository       string
+	Branch           string
+	CommitSHA        string
+	PullRequest      int
+	Author           string
+	Payload          map[string]string
+	From             time.Time
+	To               time.Time
+	Sort             string
+	Limit            int
+	Cursor           string
+}
+
+// actionCursor structure of the position of the last action of a page
+type actionCursor struct {
+	Sort string      `json:"s"`
+	Key  interface{} `json:"k"`
+	ID   int64       `json:"i"`
+}
+
+// sortKey returns the value of the sort column of an action
+func sortKey(sort string, action *GitHubAction) interface{} {
+	switch strings.TrimPrefix(sort, "-") {
+	case "created_at":
+		return action.CreatedAt.Unix()
+	case "received_at":
+		return action.ReceivedAt.Unix()
+	case "coverage":
+		return action.Payload.Coverage
+	}
+	return action.ID
+}
+
+// encodeCursor formats the cursor of the page following an action
+func encodeCursor(sort string, action *GitHubAction) string {
+	buf, _ := json.Marshal(actionCursor{Sort: sort, Key: sortKey(sort, action), ID: action.ID})
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decodeCursor reads a cursor made for a sort order
+func decodeCursor(sort, cursor string) (*actionCursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	c := &actionCursor{}
+	if err := json.Unmarshal(buf, c); err != nil || c.Sort != sort || c.Key == nil {
+		return nil, ErrBadCursor
+	}
+	return c, nil
+}
+
+// sortOrder returns the sort order of the filter, by id by default
+func (f ActionFilter) sortOrder() string {
+	if f.Sort == "" {
+		return "id"
+	}
+	return f.Sort
+}
+
+// payloadKeys returns the payload keys of the filter in order
+func (f ActionFilter) payloadKeys() []string {
+	keys := []string{}
+	for key := range f.Payload {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// payloadCondition returns the condition on the value of a payload key
+// and its arguments. PostgreSQL reads the key with its json operators,
+// sqlite with the payload_value function
+func payloadCondition(driver, key, value string) (string, []interface{}, error) {
+	path, err := payloadPath(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if driver == DriverPostgres {
+		return "coalesce(action.raw #>> CAST(? AS text[]), '') = ?",
+			[]interface{}{"{" + strings.Join(path, ",") + "}", value}, nil
+	}
+	return "payload_value(action.raw, ?) = ?", []interface{}{key, value}, nil
+}
+
+// query builds the select statement of the filter for a driver and its arguments
+func (f ActionFilter) query(driver string) (string, []interface{}, error) {
+	sort := f.sortOrder()
+	column, ok := sortColumns[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return "", nil, ErrBadSort
+	}
+	desc := strings.HasPrefix(sort, "-")
+
+	conditions := []string{}
+	args := []interface{}{}
+	for _, c := range []struct {
+		column string
+		value  string
+		op     string
+	}{
+		{"action.service_name", f.Service, "="},
+		{"action.event", f.Event, "="},
+		{"action.venture_reference", f.VentureReference, "="},
+		{"action.version", f.Version, "="},
+		{"action.repository", f.Repository, "="},
+		{"action.branch", f.Branch, "="},
+		{"action.commit_sha", f.CommitSHA, "="},
+		{"action.author", f.Author, "="},
+	} {
+		if c.value != "" {
+			conditions = append(conditions, fmt.Sprintf("%s %s ?", c.column, c.op))
+			args = append(args, c.value)
+		}
+	}
+	if f.PullRequest != 0 {
+		conditions = append(conditions, "action.pull_request = ?")
+		args = append(args, f.PullRequest)
+	}
+	for _, key := range f.payloadKeys() {
+		condition, values, err := payloadCondition(driver, key, f.Payload[key])
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+	if !f.From.IsZero() {
+		conditions = append(conditions, "action.created_at >= ?")
+		args = append(args, f.From.Unix())
+	}
+	if !f.To.IsZero() {
+		conditions = append(conditions, "action.created_at < ?")
+		args = append(args, f.To.Unix())
+	}
+
+	if f.Cursor != "" {
+		cursor, err := decodeCursor(sort, f.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		if column == "action.id" {
+			conditions = append(conditions, fmt.Sprintf("action.id %s ?", op))
+			args = append(args, cursor.ID)
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND action.id %[2]s ?))", column, op))
+			args = append(args, cursor.Key, cursor.Key, cursor.ID)
+		}
+	}
+
+	query := selectActionSQL
+	if len(conditions) > 0 {
+		query += "WHERE " + strings.Join(conditions, " AND ") + "\n"
+	}
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	if column == "action.id" {
+		query += fmt.Sprintf("ORDER BY action.id %s", direction)
+	} else {
+		query += fmt.Sprintf("ORDER BY %s %s, action.id %s", column, direction, direction)
+	}
+	if f.Limit > 0 {
+		// one more row tells if there is a next page
+		query += " LIMIT ?"
+		args = append(args, f.Limit+1)
+	}
+	return query + ";\n", args, nil
+}
+
+// Validate checks the sort order and the cursor of a filter
+func (f ActionFilter) Validate() error {
+	_, _, err := f.query(DriverSQLite)
+	return err
+}
+
+// QueryActions selects the actions matching a filter. It returns
+// the cursor of the next page or an empty string on the last page
+func (s *StatsDB) QueryActions(filter ActionFilter) ([]GitHubAction, string, error) {
+	query, args, err := filter.query(s.Driver)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := s.DB.Query(s.rebind(query), args...)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   query,
+		}).Info("Sql error")
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	actions := []GitHubAction{}
+	for rows.Next() {
+		action, err := scanAction(rows)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   query,
+			}).Info("Sql error")
+			return nil, "", err
+		}
+		if filter.Limit > 0 && len(actions) == filter.Limit {
+			return actions, encodeCursor(filter.sortOrder(), &actions[len(actions)-1]), nil
+		}
+		actions = append(actions, action)
+	}
+	if err = rows.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   query,
+		}).Info("Sql error")
+		return nil, "", err
+	}
+	return actions, "", nil
+}
+
+// EachAction passes the actions matching a filter to a function,
+// stopping at the first error of the function. Without a limit
+// the actions are read by pages of eachActionPage, no cursor of
+// the database stays open while the function runs and holds back
+// the writers of SQLite. It returns the cursor of the next page
+// or an empty string on the last page
+func (s *StatsDB) EachAction(filter ActionFilter, fn func(*GitHubAction) error) (string, error) {
+	page := filter
+	if page.Limit == 0 {
+		page.Limit = eachActionPage
+	}
+	for {
+		actions, next, err := s.QueryActions(page)
+		if err != nil {
+			return "", err
+		}
+		for i := range actions {
+			if err := fn(&actions[i]); err != nil {
+				return "", err
+			}
+		}
+		if filter.Limit > 0 || next == "" {
+			return next, nil
+		}
+		page.Cursor = next
+	}
+}
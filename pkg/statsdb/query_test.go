@@ -0,0 +1,179 @@
+package statsdb
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestStatsDB_QueryActions checks the filters, the sort orders
+// and the pages of the actions
+func TestStatsDB_QueryActions(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	for _, action := range []*GitHubAction{
+		{Event: "push", Version: "1.0.0", CreatedAt: rfc3339("2021-03-01T10:00:00Z"), Payload: &Payload{ServiceName: "shop", Coverage: 50}},
+		{Event: "push", Version: "1.0.0", CreatedAt: rfc3339("2021-03-02T10:00:00Z"), Payload: &Payload{ServiceName: "search", Coverage: 70}},
+		{Event: "release", Version: "1.1.0", CreatedAt: rfc3339("2021-03-03T10:00:00Z"), Payload: &Payload{ServiceName: "shop", Coverage: 50}},
+		{Event: "push", Version: "1.1.0", CreatedAt: rfc3339("2021-03-04T10:00:00Z"), Payload: &Payload{ServiceName: "shop", Coverage: 60},
+			Repository: "ringier/shop", Branch: "main", CommitSHA: "abc", Author: "Octo Cat"},
+		{Event: "push", VentureReference: "ch", CreatedAt: rfc3339("2021-03-05T10:00:00Z"), Payload: &Payload{ServiceName: "shop", Coverage: 40},
+			Branch: "feature", PullRequest: 412, Workflow: &WorkflowRun{Repository: "ringier/shop", HeadSHA: "def"}},
+	} {
+		if err := stats.Save(action); err != nil {
+			t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+			return
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		filter ActionFilter
+		want   []int64
+	}{
+		{name: "all", filter: ActionFilter{}, want: []int64{1, 2, 3, 4, 5}},
+		{name: "service", filter: ActionFilter{Service: "shop"}, want: []int64{1, 3, 4, 5}},
+		{name: "event", filter: ActionFilter{Service: "shop", Event: "push"}, want: []int64{1, 4, 5}},
+		{name: "version", filter: ActionFilter{Version: "1.1.0"}, want: []int64{3, 4}},
+		{name: "venture", filter: ActionFilter{VentureReference: "ch"}, want: []int64{5}},
+		{name: "range", filter: ActionFilter{From: rfc3339("2021-03-02T00:00:00Z"), To: rfc3339("2021-03-04T00:00:00Z")}, want: []int64{2, 3}},
+		{name: "desc", filter: ActionFilter{Sort: "-id"}, want: []int64{5, 4, 3, 2, 1}},
+		{name: "coverage", filter: ActionFilter{Sort: "coverage"}, want: []int64{5, 1, 3, 4, 2}},
+		{name: "coverage desc", filter: ActionFilter{Sort: "-coverage"}, want: []int64{2, 4, 3, 1, 5}},
+		{name: "created_at desc", filter: ActionFilter{Sort: "-created_at", Service: "search"}, want: []int64{2}},
+		{name: "received_at", filter: ActionFilter{Sort: "received_at", Service: "shop"}, want: []int64{1, 3, 4, 5}},
+		{name: "repository", filter: ActionFilter{Repository: "ringier/shop"}, want: []int64{4, 5}},
+		{name: "branch", filter: ActionFilter{Branch: "main", Sort: "created_at"}, want: []int64{4}},
+		{name: "commit", filter: ActionFilter{CommitSHA: "def"}, want: []int64{5}},
+		{name: "pull request", filter: ActionFilter{PullRequest: 412}, want: []int64{5}},
+		{name: "author", filter: ActionFilter{Author: "Octo Cat"}, want: []int64{4}},
+	}
+	for _, tc := range testCases {
+		actions, next, err := stats.QueryActions(tc.filter)
+		if err != nil || next != "" || !sameIDs(actions, tc.want) {
+			t.Errorf("StatsDB.QueryActions(%s): want: %v, got: %v %q %v", tc.name, tc.want, ids(actions), next, err)
+		}
+	}
+
+	for _, sort := range []string{"", "-id", "coverage", "-coverage", "created_at", "-received_at"} {
+		all, _, _ := stats.QueryActions(ActionFilter{Sort: sort})
+		got := []GitHubAction{}
+		filter := ActionFilter{Sort: sort, Limit: 2}
+		for pages := 0; pages < 5; pages++ {
+			page, next, err := stats.QueryActions(filter)
+			if err != nil {
+				t.Errorf("StatsDB.QueryActions(%q): want: %v, got: %v", sort, nil, err)
+				break
+			}
+			got = append(got, page...)
+			if next == "" {
+				break
+			}
+			filter.Cursor = next
+		}
+		if !sameIDs(got, ids(all)) {
+			t.Errorf("StatsDB.QueryActions(%q pages): want: %v, got: %v", sort, ids(all), ids(got))
+		}
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	_, err = stats.EachAction(ActionFilter{}, func(action *GitHubAction) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("StatsDB.EachAction(): want: %v after %v action, got: %v after %v", stop, 1, err, count)
+	}
+
+	// no read stays open while the function runs, the writers go on
+	count = 0
+	_, err = stats.EachAction(ActionFilter{Service: "shop"}, func(action *GitHubAction) error {
+		count++
+		return stats.Save(&GitHubAction{Event: "push", Payload: &Payload{ServiceName: "cart"}})
+	})
+	if err != nil || count != 4 {
+		t.Errorf("StatsDB.EachAction(Save): want: %v after %v actions, got: %v after %v", nil, 4, err, count)
+	}
+
+	_, next, _ := stats.QueryActions(ActionFilter{Limit: 2})
+	errorCases := []struct {
+		filter ActionFilter
+		want   error
+	}{
+		{filter: ActionFilter{Sort: "name"}, want: ErrBadSort},
+		{filter: ActionFilter{Cursor: "!!"}, want: ErrBadCursor},
+		{filter: ActionFilter{Cursor: next, Sort: "-id"}, want: ErrBadCursor},
+	}
+	for _, tc := range errorCases {
+		if _, _, err := stats.QueryActions(tc.filter); err != tc.want {
+			t.Errorf("StatsDB.QueryActions(%v): want: %v, got: %v", tc.filter, tc.want, err)
+		}
+	}
+}
+
+// ids returns the ids of actions
+func ids(actions []GitHubAction) []int64 {
+	list := []int64{}
+	for _, action := range actions {
+		list = append(list, action.ID)
+	}
+	return list
+}
+
+// sameIDs returns true if actions have the ids in the same order
+func sameIDs(actions []GitHubAction, want []int64) bool {
+	got := ids(actions)
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestStatsDB_QueryActionsPlan checks if a page of the actions of a
+// service reads the tables by index and totals only the selected actions
+func TestStatsDB_QueryActionsPlan(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	query, args, err := ActionFilter{Service: "shop", Limit: 10}.query(DriverSQLite)
+	if err != nil {
+		t.Errorf("ActionFilter.query(): want: %v, got: %v", nil, err)
+		return
+	}
+	rows, err := stats.DB.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		t.Errorf("EXPLAIN QUERY PLAN: want: %v, got: %v", nil, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Errorf("EXPLAIN QUERY PLAN: want: %v, got: %v", nil, err)
+			return
+		}
+		if strings.HasPrefix(detail, "SCAN") || strings.HasPrefix(detail, "MATERIALIZE") ||
+			strings.Contains(detail, "AUTOMATIC") {
+			t.Errorf("EXPLAIN QUERY PLAN: want: a search by index, got: %q", detail)
+		}
+	}
+}
@@ -2,71 +2,171 @@ package statsdb
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
 )
 
+// DriverSQLite driver of a SQLite database file
+const DriverSQLite = "sqlite3"
+
 // StatsDB structure of a StatsDB object
 type StatsDB struct {
-	DBName              string
-	DB                  *sql.DB
-	datadefinitionlStmt *sql.Stmt
-	createStmt          *sql.Stmt
-	selectStmt          *sql.Stmt
+	DBName         string
+	Driver         string
+	DB             *sql.DB
+	createStmt     *sql.Stmt
+	selectStmt     *sql.Stmt
+	createTestStmt *sql.Stmt
+	selectTestStmt *sql.Stmt
+	createFileStmt *sql.Stmt
+	createFuncStmt *sql.Stmt
+	selectFileStmt *sql.Stmt
+	selectFuncStmt *sql.Stmt
+
+	createDeltaStmt   *sql.Stmt
+	createPackageStmt *sql.Stmt
+	selectPackageStmt *sql.Stmt
+	lastRemoteStmt    *sql.Stmt
+	createVerdictStmt *sql.Stmt
+	selectVerdictStmt *sql.Stmt
+
+	createOutboxStmt *sql.Stmt
+	updateOutboxStmt *sql.Stmt
+	replayOutboxStmt *sql.Stmt
+	dueOutboxStmt    *sql.Stmt
+	claimOutboxStmt  *sql.Stmt
+	selectOutboxStmt *sql.Stmt
+
+	createAuditStmt *sql.Stmt
+	selectAuditStmt *sql.Stmt
+	pruneAuditStmt  *sql.Stmt
+
+	createWorkflowStmt *sql.Stmt
+
+	createSuiteStmt  *sql.Stmt
+	selectSuiteStmt  *sql.Stmt
+	commitActionStmt *sql.Stmt
+	outcomeStmt      *sql.Stmt
+	trendStmts       map[string]*sql.Stmt
 }
 
 // Payload structure of a Payload message
 type Payload struct {
-	ServiceName string  `json:"service_name"`
-	Coverage    float64 `json:"coverage"`
+	ServiceName string            `json:"service_name"`
+	Coverage    float64           `json:"coverage"`
+	NoCoverage  bool              `json:"no_coverage,omitempty"`
+	Status      string            `json:"status,omitempty"`
+	ExitCode    int               `json:"exit_code"`
+	Stderr      string            `json:"stderr,omitempty"`
+	Tests       []TestResult      `json:"tests,omitempty"`
+	Files       []FileCoverage    `json:"files,omitempty"`
+	Functions   []FuncCoverage    `json:"functions,omitempty"`
+	Packages    []PackageCoverage `json:"packages,omitempty"`
+	Suites      []TestSuite       `json:"suites,omitempty"`
+}
+
+// PackageCoverage structure of the coverage of a package
+type PackageCoverage struct {
+	Package  string  `json:"package"`
+	Coverage float64 `json:"coverage"`
 }
 
 // GitHubAction structure of a GitHubAction message
 type GitHubAction struct {
-	Event            string   `json:"event"`
-	VentureConfigId  string   `json:"venture_config_id"`
-	VentureReference string   `json:"venture_reference"`
-	CreatedAt        string   `json:"created_at"`
-	Culture          string   `json:"culture"`
-	ActionType       string   `json:"action_type"`
-	ActionReference  string   `json:"action_reference"`
-	Version          string   `json:"version"`
-	Route            string   `json:"route"`
-	Payload          *Payload `json:"payload,omitempty"`
+	ID               int64           `json:"id"`
+	Event            string          `json:"event"`
+	VentureConfigId  string          `json:"venture_config_id"`
+	VentureReference string          `json:"venture_reference"`
+	CreatedAt        time.Time       `json:"created_at"`
+	ReceivedAt       time.Time       `json:"received_at"`
+	Culture          string          `json:"culture"`
+	ActionType       string          `json:"action_type"`
+	ActionReference  string          `json:"action_reference"`
+	Version          string          `json:"version"`
+	Route            string          `json:"route"`
+	Repository       string          `json:"repository"`
+	Branch           string          `json:"branch"`
+	CommitSHA        string          `json:"commit_sha"`
+	PullRequest      int             `json:"pull_request"`
+	Author           string          `json:"author"`
+	Payload          *Payload        `json:"payload,omitempty"`
+	TriggerID        int64           `json:"trigger_id,omitempty"`
+	Delta            *CoverageDelta  `json:"delta,omitempty"`
+	Workflow         *WorkflowRun    `json:"workflow,omitempty"`
+	TestSummary      *TestSummary    `json:"test_summary,omitempty"`
+	Raw              json.RawMessage `json:"raw,omitempty" html:"-"`
 }
 
 const (
-	ddlSQL = `create table if not exists action (id INTEGER PRIMARY KEY ASC,
-	event text,venture_config_id text,venture_reference text,
-	created_at text,culture text,action_type text,
-	action_reference text,version text,route text,
-	service_name text, coverage int);
-`
 	createSQL = `INSERT INTO action (
-	event,venture_config_id,venture_reference,created_at,culture,
-	action_type,action_reference,version,route,service_name, coverage)
-	VALUES(?,?,?,?,?,?,?,?,?,?,?);
+	event,venture_config_id,venture_reference,created_at,received_at,
+	culture,action_type,action_reference,version,route,service_name,
+	coverage,status,exit_code,stderr,trigger_id,raw,
+	repository,branch,commit_sha,pull_request,author)
+	VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?);
 `
-	selectSQL = `SELECT 
+	selectActionSQL = `SELECT 
+action.id,
 event,
 venture_config_id,
 venture_reference,
 created_at,
+received_at,
 culture,
 action_type,
 action_reference,
 version,
 route,
 service_name,
-coverage
-FROM action;
+coverage,
+status,
+exit_code,
+stderr,
+trigger_id,
+raw,
+action.repository,
+action.branch,
+commit_sha,
+pull_request,
+author,
+local_id,
+remote_coverage,
+local_coverage,
+delta,
+remote_only,
+local_only,
+run_id,
+workflow_run.repository,
+workflow_run.branch,
+head_sha,
+workflow,
+conclusion,
+run_url,
+` + summarySQL + `FROM action
+LEFT JOIN coverage_delta ON coverage_delta.action_id = action.id
+LEFT JOIN workflow_run ON workflow_run.action_id = action.id
+`
+	selectSQL = selectActionSQL + `ORDER BY action.id;
 `
 )
 
 // Open open a sqlite 3 database file
 func Open(dbName string) *StatsDB {
-	db, err := sql.Open("sqlite3", dbName)
+	return OpenDriver(DriverSQLite, dbName)
+}
+
+// OpenDriver open a database of a driver, a sqlite 3 database file
+// or a PostgreSQL database given by its connection string
+func OpenDriver(driver, dbName string) *StatsDB {
+	name := driver
+	if driver == DriverSQLite {
+		name = sqliteDriver
+	}
+	db, err := sql.Open(name, dbName)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
@@ -76,71 +176,218 @@ func Open(dbName string) *StatsDB {
 
 	return &StatsDB{
 		DBName: dbName,
+		Driver: driver,
 		DB:     db,
 	}
 }
 
-// Setup creates the start table
+// prepareInsert creates a prepared insert statement
+// which returns the id of the new row
+func (s *StatsDB) prepareInsert(query string) (*sql.Stmt, error) {
+	if s.Driver == DriverPostgres {
+		query = returningID(query)
+	}
+	return s.prepare(query)
+}
+
+// rebind adapts the placeholders of a query to the driver
+func (s *StatsDB) rebind(query string) string {
+	if s.Driver == DriverPostgres {
+		return rebind(query)
+	}
+	return query
+}
+
+// Setup migrates the schema to the latest version
+// and prepares the statements
 func (s *StatsDB) Setup() error {
-	ddlStmt, err := s.DB.Prepare(ddlSQL)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Error": err,
-		}).Info("Sql error")
+	if err := s.Migrate(LatestVersion()); err != nil {
 		return err
 	}
-	s.datadefinitionlStmt = ddlStmt
 
-	_, err = s.datadefinitionlStmt.Exec()
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Error": err,
-			"sql":   ddlSQL,
-		}).Info("Sql error")
+	var err error
+	if s.createStmt, err = s.prepareInsert(createSQL); err != nil {
+		return err
+	}
+	if s.selectStmt, err = s.prepare(selectSQL); err != nil {
+		return err
+	}
+	if s.createTestStmt, err = s.prepare(createTestSQL); err != nil {
+		return err
+	}
+	if s.selectTestStmt, err = s.prepare(selectTestSQL); err != nil {
+		return err
+	}
+	if s.createFileStmt, err = s.prepare(createFileSQL); err != nil {
+		return err
+	}
+	if s.createFuncStmt, err = s.prepare(createFuncSQL); err != nil {
+		return err
+	}
+	if s.selectFileStmt, err = s.prepare(selectFileSQL); err != nil {
+		return err
+	}
+	if s.selectFuncStmt, err = s.prepare(selectFuncSQL); err != nil {
+		return err
+	}
+	if s.createDeltaStmt, err = s.prepare(createDeltaSQL); err != nil {
+		return err
+	}
+	if s.createPackageStmt, err = s.prepare(createPackageSQL); err != nil {
+		return err
+	}
+	if s.selectPackageStmt, err = s.prepare(selectPackageSQL); err != nil {
+		return err
+	}
+	if s.lastRemoteStmt, err = s.prepare(lastRemoteSQL); err != nil {
+		return err
+	}
+	if s.createVerdictStmt, err = s.prepare(createVerdictSQL); err != nil {
+		return err
+	}
+	if s.selectVerdictStmt, err = s.prepare(selectVerdictSQL); err != nil {
+		return err
+	}
+	if s.createOutboxStmt, err = s.prepareInsert(createOutboxSQL); err != nil {
+		return err
+	}
+	if s.updateOutboxStmt, err = s.prepare(updateOutboxSQL); err != nil {
+		return err
+	}
+	if s.replayOutboxStmt, err = s.prepare(replayOutboxSQL); err != nil {
+		return err
+	}
+	if s.dueOutboxStmt, err = s.prepare(dueOutboxSQL); err != nil {
+		return err
+	}
+	if s.claimOutboxStmt, err = s.prepare(claimOutboxSQL); err != nil {
 		return err
 	}
+	if s.selectOutboxStmt, err = s.prepare(selectOutboxSQL); err != nil {
+		return err
+	}
+	if s.createAuditStmt, err = s.prepareInsert(createAuditSQL); err != nil {
+		return err
+	}
+	if s.selectAuditStmt, err = s.prepare(selectAuditSQL); err != nil {
+		return err
+	}
+	if s.pruneAuditStmt, err = s.prepare(pruneAuditSQL); err != nil {
+		return err
+	}
+	if s.createWorkflowStmt, err = s.prepare(createWorkflowSQL); err != nil {
+		return err
+	}
+	if s.createSuiteStmt, err = s.prepare(createSuiteSQL); err != nil {
+		return err
+	}
+	if s.selectSuiteStmt, err = s.prepare(selectSuiteSQL); err != nil {
+		return err
+	}
+	if s.commitActionStmt, err = s.prepare(commitActionSQL); err != nil {
+		return err
+	}
+	if s.outcomeStmt, err = s.prepare(outcomeSQL); err != nil {
+		return err
+	}
+	s.trendStmts = map[string]*sql.Stmt{}
+	for bucket, column := range s.buckets() {
+		if s.trendStmts[bucket], err = s.prepare(fmt.Sprintf(trendSQL, column)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	createStmt, err := s.DB.Prepare(createSQL)
+// prepare creates a prepared statement logging any failure
+func (s *StatsDB) prepare(query string) (*sql.Stmt, error) {
+	stmt, err := s.DB.Prepare(s.rebind(query))
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
+			"sql":   query,
 		}).Info("Sql error")
-		return err
+		return nil, err
 	}
-	selectStmt, err := s.DB.Prepare(selectSQL)
+	return stmt, nil
+}
+
+// Save inserts a github action into the action table
+// together with the results of its tests and its coverage.
+// An action without a receive time is stamped with the current time
+// and an action without a created_at time gets its receive time.
+// An action of a workflow run gets its repository, branch and commit
+func (s *StatsDB) Save(action *GitHubAction) error {
+	stampTimes(action)
+	stampSource(action)
+
+	tx, err := s.DB.Begin()
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
 		}).Info("Sql error")
 		return err
 	}
-	s.createStmt = createStmt
-	s.selectStmt = selectStmt
-	return nil
-}
 
-// Save inserts a github action into the action table
-func (s *StatsDB) Save(action *GitHubAction) error {
-
-	_, err := s.createStmt.Exec(action.Event,
+	id, err := s.insert(tx.Stmt(s.createStmt), action.Event,
 		action.VentureConfigId,
 		action.VentureReference,
-		action.CreatedAt,
+		action.CreatedAt.Unix(),
+		action.ReceivedAt.Unix(),
 		action.Culture,
 		action.ActionType,
 		action.ActionReference,
 		action.Version,
 		action.Route,
 		action.Payload.ServiceName,
-		action.Payload.Coverage)
+		coverageValue(action.Payload),
+		action.Payload.Status,
+		action.Payload.ExitCode,
+		action.Payload.Stderr,
+		action.TriggerID,
+		rawValue(action.Raw),
+		action.Repository,
+		action.Branch,
+		action.CommitSHA,
+		action.PullRequest,
+		action.Author)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
 			"sql":   createSQL,
 		}).Info("Sql error")
+		tx.Rollback()
+		return err
+	}
+
+	if err := s.saveTestResults(tx, id, action.Payload.Tests); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := s.saveCoverage(tx, id, action.Payload); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := s.saveWorkflowRun(tx, id, action.Workflow); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := s.saveTestSuites(tx, id, action.Payload.Suites); err != nil {
+		tx.Rollback()
 		return err
 	}
 
+	if err := tx.Commit(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Sql error")
+		return err
+	}
+	action.ID = id
+
 	return nil
 }
 
@@ -154,21 +401,11 @@ func (s *StatsDB) GetAllActions() []GitHubAction {
 		}).Info("Sql error")
 		return nil
 	}
+	defer rows.Close()
 
 	events := []GitHubAction{}
 	for rows.Next() {
-		tracker := GitHubAction{Payload: &Payload{}}
-		err = rows.Scan(&tracker.Event,
-			&tracker.VentureConfigId,
-			&tracker.VentureReference,
-			&tracker.CreatedAt,
-			&tracker.Culture,
-			&tracker.ActionType,
-			&tracker.ActionReference,
-			&tracker.Version,
-			&tracker.Route,
-			&tracker.Payload.ServiceName,
-			&tracker.Payload.Coverage)
+		tracker, err := scanAction(rows)
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"Error": err,
@@ -189,3 +426,70 @@ func (s *StatsDB) GetAllActions() []GitHubAction {
 
 	return events
 }
+
+// scanAction reads an action selected by selectActionSQL
+func scanAction(rows *sql.Rows) (GitHubAction, error) {
+	tracker := GitHubAction{Payload: &Payload{}}
+	delta := deltaColumns{}
+	workflow := workflowColumns{}
+	summary := summaryColumns{}
+	var createdAt, receivedAt int64
+	var coverage sql.NullFloat64
+	var raw sql.NullString
+	dest := append(append(delta.dest(), workflow.dest()...), summary.dest()...)
+	err := rows.Scan(append([]interface{}{&tracker.ID,
+		&tracker.Event,
+		&tracker.VentureConfigId,
+		&tracker.VentureReference,
+		&createdAt,
+		&receivedAt,
+		&tracker.Culture,
+		&tracker.ActionType,
+		&tracker.ActionReference,
+		&tracker.Version,
+		&tracker.Route,
+		&tracker.Payload.ServiceName,
+		&coverage,
+		&tracker.Payload.Status,
+		&tracker.Payload.ExitCode,
+		&tracker.Payload.Stderr,
+		&tracker.TriggerID,
+		&raw,
+		&tracker.Repository,
+		&tracker.Branch,
+		&tracker.CommitSHA,
+		&tracker.PullRequest,
+		&tracker.Author}, dest...)...)
+	if err != nil {
+		return tracker, err
+	}
+	tracker.CreatedAt = time.Unix(createdAt, 0).UTC()
+	tracker.ReceivedAt = time.Unix(receivedAt, 0).UTC()
+	tracker.Payload.Coverage = coverage.Float64
+	tracker.Payload.NoCoverage = !coverage.Valid
+	if raw.String != "" {
+		tracker.Raw = json.RawMessage(raw.String)
+	}
+	tracker.Delta = delta.delta(tracker.ID)
+	tracker.Workflow = workflow.run(tracker.ID)
+	tracker.TestSummary = summary.summary()
+	return tracker, nil
+}
+
+// coverageValue returns the coverage an action is stored with,
+// NULL for an action which carries no coverage
+func coverageValue(payload *Payload) interface{} {
+	if payload.NoCoverage {
+		return nil
+	}
+	return payload.Coverage
+}
+
+// unixTime returns the unix time a time is stored with,
+// the zero time is stored as 0
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
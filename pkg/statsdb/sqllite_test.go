@@ -3,6 +3,7 @@ package statsdb
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 // TestStatsDB_Open checks if opening the database works
@@ -42,7 +43,7 @@ func TestStatsDB_Save(t *testing.T) {
 				Event:            "TrackTestCoverageEvent",
 				VentureConfigId:  "1",
 				VentureReference: "1",
-				CreatedAt:        "2021-03-02T08:30:00+00:00",
+				CreatedAt:        rfc3339("2021-03-02T08:30:00+00:00"),
 				Culture:          "en_EN",
 				ActionType:       "api",
 				ActionReference:  "",
@@ -60,7 +61,7 @@ func TestStatsDB_Save(t *testing.T) {
 				Event:            "TrackTestCoverageEvent",
 				VentureConfigId:  "2",
 				VentureReference: "2",
-				CreatedAt:        "2021-03-02T08:30:00+00:00",
+				CreatedAt:        rfc3339("2021-03-02T08:30:00+00:00"),
 				Culture:          "en_EN",
 				ActionType:       "api",
 				ActionReference:  "",
@@ -102,7 +103,7 @@ func TestStatsDB_GetAllActions(t *testing.T) {
 				Event:            "TrackTestCoverageEvent",
 				VentureConfigId:  "1",
 				VentureReference: "1",
-				CreatedAt:        "2021-03-02T08:30:00+00:00",
+				CreatedAt:        rfc3339("2021-03-02T08:30:00+00:00"),
 				Culture:          "en_EN",
 				ActionType:       "api",
 				ActionReference:  "",
@@ -120,7 +121,7 @@ func TestStatsDB_GetAllActions(t *testing.T) {
 				Event:            "TrackTestCoverageEvent",
 				VentureConfigId:  "2",
 				VentureReference: "2",
-				CreatedAt:        "2021-03-02T08:30:00+00:00",
+				CreatedAt:        rfc3339("2021-03-02T08:30:00+00:00"),
 				Culture:          "en_EN",
 				ActionType:       "api",
 				ActionReference:  "",
@@ -152,3 +153,100 @@ func TestStatsDB_GetAllActions(t *testing.T) {
 		return
 	}
 }
+
+// TestStatsDB_SaveTimes checks if the created_at time is stored in UTC
+// and if the receive time is stamped on every action
+func TestStatsDB_SaveTimes(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	before := time.Now().Add(-time.Second)
+	testCases := []struct {
+		action *GitHubAction
+		want   time.Time
+	}{
+		{
+			action: &GitHubAction{CreatedAt: rfc3339("2021-03-02T10:30:00+02:00"), Payload: &Payload{ServiceName: "test"}},
+			want:   time.Date(2021, 3, 2, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			action: &GitHubAction{Payload: &Payload{ServiceName: "test"}},
+		},
+	}
+	for _, tc := range testCases {
+		if err := stats.Save(tc.action); err != nil {
+			t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+			return
+		}
+	}
+
+	all := stats.GetAllActions()
+	if len(all) != len(testCases) {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", len(testCases), len(all))
+		return
+	}
+	for i, tc := range testCases {
+		got := all[i]
+		if got.ReceivedAt.Before(before.Truncate(time.Second)) || got.ReceivedAt.Location() != time.UTC {
+			t.Errorf("StatsDB.GetAllActions() received_at: want: after %v, got: %v", before, got.ReceivedAt)
+		}
+		want := tc.want
+		if want.IsZero() {
+			want = got.ReceivedAt
+		}
+		if !got.CreatedAt.Equal(want) {
+			t.Errorf("StatsDB.GetAllActions() created_at: want: %v, got: %v", want, got.CreatedAt)
+		}
+	}
+}
+
+// TestStatsDB_SaveFailedRun checks if the outcome of a failed
+// test run is stored
+func TestStatsDB_SaveFailedRun(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	action := &GitHubAction{
+		Event:   "ringier",
+		Culture: "en_EN",
+		Payload: &Payload{
+			ServiceName: "test",
+			Status:      "error",
+			ExitCode:    2,
+			Stderr:      "build failed\n",
+		},
+	}
+	if err := stats.Save(action); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+
+	all := stats.GetAllActions()
+	if len(all) != 1 {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", 1, len(all))
+		return
+	}
+	got := all[0].Payload
+	if got.Status != "error" || got.ExitCode != 2 || got.Stderr != "build failed\n" {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", action.Payload, got)
+	}
+}
+
+// rfc3339 parses a time of a test case
+func rfc3339(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
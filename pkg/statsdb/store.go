@@ -0,0 +1,81 @@
+package statsdb
+
+import (
+	"time"
+)
+
+// Store the storage of the actions and of everything derived from them.
+// StatsDB keeps them in SQLite, MemStore in memory
+type Store interface {
+	// Setup prepares the storage before its first use
+	Setup() error
+
+	// actions and their results
+	Save(action *GitHubAction) error
+	GetAllActions() []GitHubAction
+	QueryActions(filter ActionFilter) ([]GitHubAction, string, error)
+	EachAction(filter ActionFilter, fn func(*GitHubAction) error) (string, error)
+	GetTestResults(actionID int64) []TestResult
+	GetCoverage(actionID int64) *CoverageReport
+	GetPackageCoverage(actionID int64) []PackageCoverage
+	GetTestSuites(actionID int64) []TestSuite
+	AddTestReport(actionID int64, suites []TestSuite, tests []TestResult) error
+	CommitAction(service, commit string) int64
+	SaveDelta(delta *CoverageDelta) error
+
+	// aggregates of the actions
+	LastCoverage(service string) *Payload
+	GetTestOutcomes(service string, window int) []TestOutcome
+	CoverageTrend(service, bucket string, from, to time.Time) ([]TrendPoint, error)
+
+	// verdicts of the coverage policies
+	SaveVerdict(verdict *Verdict) error
+	GetVerdict(service string) *Verdict
+
+	// outbox of the events to deliver
+	Enqueue(sink, event string) (int64, error)
+	UpdateDelivery(event *OutboxEvent) error
+	Replay(id int64) error
+	ClaimEvents(sink string, now, until time.Time, limit int) []OutboxEvent
+	GetOutbox(status string) []OutboxEvent
+
+	// audit of the rejected requests
+	SaveAuthFailure(failure *AuthFailure) error
+	GetAuthFailures(limit int) []AuthFailure
+}
+
+var (
+	_ Store = (*StatsDB)(nil)
+	_ Store = (*MemStore)(nil)
+)
+
+// stampTimes sets the receive time of an action about to be stored
+// and its created_at time if it has none. Both are kept in UTC
+// with the precision of a second they are stored with
+func stampTimes(action *GitHubAction) {
+	if action.ReceivedAt.IsZero() {
+		action.ReceivedAt = time.Now()
+	}
+	if action.CreatedAt.IsZero() {
+		action.CreatedAt = action.ReceivedAt
+	}
+	action.ReceivedAt = action.ReceivedAt.UTC().Truncate(time.Second)
+	action.CreatedAt = action.CreatedAt.UTC().Truncate(time.Second)
+}
+
+// stampSource sets the repository, the branch and the commit
+// an action about to be stored has not from its workflow run
+func stampSource(action *GitHubAction) {
+	if action.Workflow == nil {
+		return
+	}
+	if action.Repository == "" {
+		action.Repository = action.Workflow.Repository
+	}
+	if action.Branch == "" {
+		action.Branch = action.Workflow.Branch
+	}
+	if action.CommitSHA == "" {
+		action.CommitSHA = action.Workflow.HeadSHA
+	}
+}
@@ -0,0 +1,95 @@
+package statsdb
+
+import (
+	"database/sql"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestResult structure of the result of a single test
+type TestResult struct {
+	Package string  `json:"package"`
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`
+	Elapsed float64 `json:"elapsed"`
+	Output  string  `json:"output,omitempty"`
+}
+
+const (
+	createTestSQL = `INSERT INTO test_result (
+	action_id,package,name,status,elapsed,output)
+	VALUES(?,?,?,?,?,?);
+`
+	selectTestSQL = `SELECT 
+package,
+name,
+status,
+elapsed,
+output
+FROM test_result
+WHERE action_id = ?
+ORDER BY id;
+`
+)
+
+// saveTestResults inserts the test results of an action
+// into the test_result table
+func (s *StatsDB) saveTestResults(tx *sql.Tx, actionID int64, tests []TestResult) error {
+	stmt := tx.Stmt(s.createTestStmt)
+	for _, test := range tests {
+		_, err := stmt.Exec(actionID,
+			test.Package,
+			test.Name,
+			test.Status,
+			test.Elapsed,
+			test.Output)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   createTestSQL,
+			}).Info("Sql error")
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTestResults selects the test results stored for an action
+func (s *StatsDB) GetTestResults(actionID int64) []TestResult {
+	rows, err := s.selectTestStmt.Query(actionID)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectTestSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	defer rows.Close()
+
+	tests := []TestResult{}
+	for rows.Next() {
+		test := TestResult{}
+		err = rows.Scan(&test.Package,
+			&test.Name,
+			&test.Status,
+			&test.Elapsed,
+			&test.Output)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   selectTestSQL,
+			}).Info("Sql error")
+			return nil
+		}
+		tests = append(tests, test)
+	}
+	if err = rows.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectTestSQL,
+		}).Info("Sql error")
+		return nil
+	}
+
+	return tests
+}
@@ -0,0 +1,55 @@
+package statsdb
+
+import (
+	"os"
+	"testing"
+)
+
+// TestStatsDB_GetTestResults checks if the test results of an action
+// are stored and retrieved with it
+func TestStatsDB_GetTestResults(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	action := &GitHubAction{
+		Event:   "ringier/pkg/statsdb",
+		Culture: "en_EN",
+		Payload: &Payload{
+			ServiceName: "test",
+			Coverage:    23.5,
+			Status:      "fail",
+			Tests: []TestResult{
+				{Package: "ringier/pkg/statsdb", Name: "TestA", Status: "pass", Elapsed: 0.1},
+				{Package: "ringier/pkg/statsdb", Name: "TestB", Status: "fail", Elapsed: 0.2, Output: "boom\n"},
+			},
+		},
+	}
+	if err := stats.Save(action); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+	if action.ID == 0 {
+		t.Errorf("StatsDB.Save(): want: an action id, got: %v", action.ID)
+	}
+
+	got := stats.GetTestResults(action.ID)
+	if len(got) != len(action.Payload.Tests) {
+		t.Errorf("StatsDB.GetTestResults(%d): want: %v, got: %v", action.ID, len(action.Payload.Tests), len(got))
+		return
+	}
+	for i, want := range action.Payload.Tests {
+		if got[i] != want {
+			t.Errorf("StatsDB.GetTestResults(%d)[%d]: want: %v, got: %v", action.ID, i, want, got[i])
+		}
+	}
+
+	all := stats.GetAllActions()
+	if len(all) != 1 || all[0].Payload.Status != "fail" {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", "fail", all)
+	}
+}
@@ -0,0 +1,223 @@
+package statsdb
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestSuite structure of a suite of a JUnit test report
+type TestSuite struct {
+	Name      string  `json:"name"`
+	Tests     int     `json:"tests"`
+	Failures  int     `json:"failures"`
+	Errors    int     `json:"errors"`
+	Skipped   int     `json:"skipped"`
+	Time      float64 `json:"time"`
+	Timestamp string  `json:"timestamp,omitempty"`
+}
+
+// TestSummary structure of the totals of the test results of an action
+type TestSummary struct {
+	Tests   int     `json:"tests"`
+	Passed  int     `json:"passed"`
+	Failed  int     `json:"failed"`
+	Skipped int     `json:"skipped"`
+	Elapsed float64 `json:"elapsed"`
+}
+
+// String formats the summary for the web page
+func (t *TestSummary) String() string {
+	if t == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d tests: %d passed, %d failed, %d skipped in %.2fs",
+		t.Tests, t.Passed, t.Failed, t.Skipped, t.Elapsed)
+}
+
+const (
+	createSuiteSQL = `INSERT INTO test_suite (
+	action_id,name,tests,failures,errors,skipped,time,timestamp)
+	VALUES(?,?,?,?,?,?,?,?);
+`
+	selectSuiteSQL = `SELECT 
+name,
+tests,
+failures,
+errors,
+skipped,
+time,
+timestamp
+FROM test_suite
+WHERE action_id = ?
+ORDER BY id;
+`
+	commitActionSQL = `SELECT 
+id
+FROM action
+WHERE service_name = ? AND commit_sha = ? AND trigger_id = 0
+ORDER BY id DESC
+LIMIT 1;
+`
+	// summarySQL the columns of the totals of the test results of
+	// an action selected by selectActionSQL. They are subqueries on
+	// the results of the action, only the selected actions are totaled
+	summarySQL = `(SELECT nullif(count(*), 0) FROM test_result
+	WHERE test_result.action_id = action.id) AS tests,
+(SELECT sum(CASE WHEN status = 'pass' THEN 1 ELSE 0 END) FROM test_result
+	WHERE test_result.action_id = action.id) AS passed,
+(SELECT sum(CASE WHEN status IN ('fail', 'error') THEN 1 ELSE 0 END) FROM test_result
+	WHERE test_result.action_id = action.id) AS failed,
+(SELECT sum(CASE WHEN status = 'skip' THEN 1 ELSE 0 END) FROM test_result
+	WHERE test_result.action_id = action.id) AS skipped,
+(SELECT sum(elapsed) FROM test_result
+	WHERE test_result.action_id = action.id) AS elapsed
+`
+)
+
+// saveTestSuites inserts the test suites of an action
+// into the test_suite table
+func (s *StatsDB) saveTestSuites(tx *sql.Tx, actionID int64, suites []TestSuite) error {
+	stmt := tx.Stmt(s.createSuiteStmt)
+	for _, suite := range suites {
+		_, err := stmt.Exec(actionID,
+			suite.Name,
+			suite.Tests,
+			suite.Failures,
+			suite.Errors,
+			suite.Skipped,
+			suite.Time,
+			suite.Timestamp)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   createSuiteSQL,
+			}).Info("Sql error")
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTestReport inserts the test suites and the test results
+// of a report into an action already stored
+func (s *StatsDB) AddTestReport(actionID int64, suites []TestSuite, tests []TestResult) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Sql error")
+		return err
+	}
+	if err := s.saveTestSuites(tx, actionID, suites); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.saveTestResults(tx, actionID, tests); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Sql error")
+		return err
+	}
+	return nil
+}
+
+// CommitAction selects the last action of a service received
+// for a commit, leaving out the actions of local runs.
+// It returns 0 if there is none
+func (s *StatsDB) CommitAction(service, commit string) int64 {
+	var id int64
+	err := s.commitActionStmt.QueryRow(service, commit).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   commitActionSQL,
+		}).Info("Sql error")
+		return 0
+	}
+	return id
+}
+
+// GetTestSuites selects the test suites stored for an action
+func (s *StatsDB) GetTestSuites(actionID int64) []TestSuite {
+	rows, err := s.selectSuiteStmt.Query(actionID)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectSuiteSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	defer rows.Close()
+
+	suites := []TestSuite{}
+	for rows.Next() {
+		suite := TestSuite{}
+		err = rows.Scan(&suite.Name,
+			&suite.Tests,
+			&suite.Failures,
+			&suite.Errors,
+			&suite.Skipped,
+			&suite.Time,
+			&suite.Timestamp)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   selectSuiteSQL,
+			}).Info("Sql error")
+			return nil
+		}
+		suites = append(suites, suite)
+	}
+	if err = rows.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectSuiteSQL,
+		}).Info("Sql error")
+		return nil
+	}
+
+	return suites
+}
+
+// summaryColumns structure of the nullable test totals
+// joined to an action
+type summaryColumns struct {
+	Tests   sql.NullInt64
+	Passed  sql.NullInt64
+	Failed  sql.NullInt64
+	Skipped sql.NullInt64
+	Elapsed sql.NullFloat64
+}
+
+// dest returns the scan destinations of the columns
+func (c *summaryColumns) dest() []interface{} {
+	return []interface{}{&c.Tests,
+		&c.Passed,
+		&c.Failed,
+		&c.Skipped,
+		&c.Elapsed}
+}
+
+// summary returns the test totals of an action
+// or nil if it has no test result
+func (c *summaryColumns) summary() *TestSummary {
+	if !c.Tests.Valid {
+		return nil
+	}
+	return &TestSummary{
+		Tests:   int(c.Tests.Int64),
+		Passed:  int(c.Passed.Int64),
+		Failed:  int(c.Failed.Int64),
+		Skipped: int(c.Skipped.Int64),
+		Elapsed: c.Elapsed.Float64,
+	}
+}
@@ -0,0 +1,75 @@
+package statsdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestStatsDB_TestReport checks if test reports are stored with
+// a new action or added to the action of a commit
+func TestStatsDB_TestReport(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	suites := []TestSuite{{Name: "cart", Tests: 2, Failures: 1, Time: 1.5}}
+	tests := []TestResult{
+		{Package: "cart", Name: "adds", Status: "pass", Elapsed: 0.5},
+		{Package: "cart", Name: "removes", Status: "fail", Elapsed: 1},
+	}
+	action := &GitHubAction{Event: "push", Payload: &Payload{ServiceName: "shop", Tests: tests, Suites: suites},
+		Workflow: &WorkflowRun{HeadSHA: "4f2a9c1"}}
+	if err := stats.Save(action); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+	other := &GitHubAction{Event: "push", Payload: &Payload{ServiceName: "search"}}
+	if err := stats.Save(other); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+
+	testCases := []struct {
+		service string
+		commit  string
+		want    int64
+	}{
+		{service: "shop", commit: "4f2a9c1", want: action.ID},
+		{service: "search", commit: "4f2a9c1", want: 0},
+		{service: "shop", commit: "0000000", want: 0},
+	}
+	for _, tc := range testCases {
+		if got := stats.CommitAction(tc.service, tc.commit); got != tc.want {
+			t.Errorf("StatsDB.CommitAction(%q, %q): want: %v, got: %v", tc.service, tc.commit, tc.want, got)
+		}
+	}
+
+	if err := stats.AddTestReport(action.ID, []TestSuite{{Name: "user", Tests: 1, Skipped: 1}},
+		[]TestResult{{Package: "user", Name: "logs in", Status: "skip"}}); err != nil {
+		t.Errorf("StatsDB.AddTestReport(): want: %v, got: %v", nil, err)
+	}
+	if got := stats.GetTestSuites(action.ID); len(got) != 2 || !reflect.DeepEqual(got[0], suites[0]) {
+		t.Errorf("StatsDB.GetTestSuites(%d): want: %v and one more, got: %v", action.ID, suites, got)
+	}
+
+	actions := stats.GetAllActions()
+	if len(actions) != 2 {
+		t.Errorf("StatsDB.GetAllActions(): want: %v actions, got: %v", 2, len(actions))
+		return
+	}
+	want := &TestSummary{Tests: 3, Passed: 1, Failed: 1, Skipped: 1, Elapsed: 1.5}
+	if !reflect.DeepEqual(actions[0].TestSummary, want) {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", want, actions[0].TestSummary)
+	}
+	if actions[1].TestSummary != nil {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", nil, actions[1].TestSummary)
+	}
+	if got, want := want.String(), "3 tests: 1 passed, 1 failed, 1 skipped in 1.50s"; got != want {
+		t.Errorf("TestSummary.String(): want: %q, got: %q", want, got)
+	}
+}
@@ -0,0 +1,133 @@
+package statsdb
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrBadBucket the time bucket of a trend is not supported
+var ErrBadBucket = errors.New("statsdb: unknown time bucket")
+
+// sqliteBuckets the columns of the time buckets of a trend in SQLite
+var sqliteBuckets = map[string]string{
+	"hour":  "strftime('%Y-%m-%dT%H:00', created_at, 'unixepoch')",
+	"day":   "strftime('%Y-%m-%d', created_at, 'unixepoch')",
+	"week":  "strftime('%Y-W%W', created_at, 'unixepoch')",
+	"month": "strftime('%Y-%m', created_at, 'unixepoch')",
+}
+
+// TrendPoint structure of the coverage of a service in a time bucket
+type TrendPoint struct {
+	ServiceName string  `json:"service_name"`
+	Bucket      string  `json:"bucket"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	Avg         float64 `json:"avg"`
+	Last        float64 `json:"last"`
+	Count       int     `json:"count"`
+}
+
+const (
+	trendSQL = `WITH bucketed AS (
+SELECT 
+service_name,
+coverage,
+%s AS bucket,
+row_number() OVER (
+PARTITION BY service_name, %[1]s
+ORDER BY created_at DESC, id DESC
+) AS run
+FROM action
+WHERE trigger_id = 0 AND coverage IS NOT NULL
+AND (? = '' OR service_name = ?)
+AND (CAST(? AS BIGINT) = 0 OR created_at >= ?)
+AND (CAST(? AS BIGINT) = 0 OR created_at < ?)
+)
+SELECT 
+trend.service_name,
+trend.bucket,
+min_coverage,
+max_coverage,
+avg_coverage,
+last.coverage,
+count
+FROM (
+SELECT 
+service_name,
+bucket,
+min(coverage) AS min_coverage,
+max(coverage) AS max_coverage,
+avg(coverage) AS avg_coverage,
+count(*) AS count
+FROM bucketed
+GROUP BY service_name, bucket
+) AS trend
+JOIN bucketed AS last ON last.service_name = trend.service_name
+AND last.bucket = trend.bucket AND last.run = 1
+ORDER BY trend.service_name, trend.bucket;
+`
+)
+
+// buckets returns the columns of the time buckets of the driver
+func (s *StatsDB) buckets() map[string]string {
+	if s.Driver == DriverPostgres {
+		return pgBuckets
+	}
+	return sqliteBuckets
+}
+
+// CoverageTrend aggregates the coverage reported for a service
+// by UTC time bucket of their created_at time. An empty service
+// aggregates every service on its own, a zero from or to
+// leaves the range open. The last coverage is the one of the
+// latest created action of the bucket. Local runs and actions without coverage
+// are left out
+func (s *StatsDB) CoverageTrend(service, bucket string, from, to time.Time) ([]TrendPoint, error) {
+	stmt, ok := s.trendStmts[bucket]
+	if !ok {
+		return nil, ErrBadBucket
+	}
+	rows, err := stmt.Query(service, service,
+		unixTime(from), unixTime(from), unixTime(to), unixTime(to))
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   trendSQL,
+		}).Info("Sql error")
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []TrendPoint{}
+	for rows.Next() {
+		point := TrendPoint{}
+		err = rows.Scan(&point.ServiceName,
+			&point.Bucket,
+			&point.Min,
+			&point.Max,
+			&point.Avg,
+			&point.Last,
+			&point.Count)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sql":   trendSQL,
+			}).Info("Sql error")
+			return nil, err
+		}
+		point.Avg = math.Round(point.Avg*100) / 100
+		points = append(points, point)
+	}
+	if err = rows.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   trendSQL,
+		}).Info("Sql error")
+		return nil, err
+	}
+
+	return points, nil
+}
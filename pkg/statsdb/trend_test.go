@@ -0,0 +1,70 @@
+package statsdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestStatsDB_CoverageTrend checks the aggregation of the coverage
+// by service and time bucket
+func TestStatsDB_CoverageTrend(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	for _, action := range []*GitHubAction{
+		{CreatedAt: rfc3339("2021-03-01T08:00:00Z"), Payload: &Payload{ServiceName: "shop", Coverage: 50}},
+		{CreatedAt: rfc3339("2021-03-01T20:00:00+02:00"), Payload: &Payload{ServiceName: "shop", Coverage: 40}},
+		{CreatedAt: rfc3339("2021-03-01T23:30:00+00:00"), Payload: &Payload{ServiceName: "shop", Coverage: 45}},
+		{CreatedAt: rfc3339("2021-03-02T08:30:00Z"), Payload: &Payload{ServiceName: "shop", Coverage: 60}},
+		{CreatedAt: rfc3339("2021-03-02T08:30:00Z"), Payload: &Payload{ServiceName: "shop", Coverage: 10}, TriggerID: 4},
+		{CreatedAt: rfc3339("2021-03-01T09:00:00Z"), Payload: &Payload{ServiceName: "search", Coverage: 70}},
+		{CreatedAt: rfc3339("2021-03-02T09:00:00Z"), Payload: &Payload{ServiceName: "shop", NoCoverage: true}},
+		{CreatedAt: rfc3339("2021-03-01T07:00:00Z"), Payload: &Payload{ServiceName: "search", Coverage: 30}},
+	} {
+		if err := stats.Save(action); err != nil {
+			t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+			return
+		}
+	}
+
+	testCases := []struct {
+		service string
+		bucket  string
+		from    time.Time
+		to      time.Time
+		want    []TrendPoint
+	}{
+		{service: "shop", bucket: "day", want: []TrendPoint{
+			{ServiceName: "shop", Bucket: "2021-03-01", Min: 40, Max: 50, Avg: 45, Last: 45, Count: 3},
+			{ServiceName: "shop", Bucket: "2021-03-02", Min: 60, Max: 60, Avg: 60, Last: 60, Count: 1},
+		}},
+		{bucket: "month", want: []TrendPoint{
+			{ServiceName: "search", Bucket: "2021-03", Min: 30, Max: 70, Avg: 50, Last: 70, Count: 2},
+			{ServiceName: "shop", Bucket: "2021-03", Min: 40, Max: 60, Avg: 48.75, Last: 60, Count: 4},
+		}},
+		{service: "shop", bucket: "hour", from: rfc3339("2021-03-02T00:00:00Z"), want: []TrendPoint{
+			{ServiceName: "shop", Bucket: "2021-03-02T08:00", Min: 60, Max: 60, Avg: 60, Last: 60, Count: 1},
+		}},
+		{service: "shop", bucket: "week", to: rfc3339("2021-03-01T12:00:00Z"), want: []TrendPoint{
+			{ServiceName: "shop", Bucket: "2021-W09", Min: 50, Max: 50, Avg: 50, Last: 50, Count: 1},
+		}},
+		{service: "other", bucket: "day", want: []TrendPoint{}},
+	}
+	for _, tc := range testCases {
+		got, err := stats.CoverageTrend(tc.service, tc.bucket, tc.from, tc.to)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("StatsDB.CoverageTrend(%q, %q): want: %v, got: %v %v", tc.service, tc.bucket, tc.want, got, err)
+		}
+	}
+
+	if _, err := stats.CoverageTrend("shop", "year", time.Time{}, time.Time{}); err != ErrBadBucket {
+		t.Errorf("StatsDB.CoverageTrend(%q): want: %v, got: %v", "year", ErrBadBucket, err)
+	}
+}
@@ -0,0 +1,106 @@
+package statsdb
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Verdict structure of the outcome of the coverage policy
+// evaluated for an action
+type Verdict struct {
+	ActionID    int64    `json:"action_id"`
+	ServiceName string   `json:"service_name"`
+	Passed      bool     `json:"passed"`
+	Reasons     []string `json:"reasons"`
+}
+
+const (
+	createVerdictSQL = `INSERT INTO verdict (
+	action_id,service_name,passed,reasons)
+	VALUES(?,?,?,?);
+`
+	selectVerdictSQL = `SELECT 
+action_id,
+service_name,
+passed,
+reasons
+FROM verdict
+WHERE service_name = ?
+ORDER BY id DESC
+LIMIT 1;
+`
+	lastRemoteSQL = `SELECT 
+id,
+coverage
+FROM action
+WHERE service_name = ? AND trigger_id = 0 AND coverage IS NOT NULL
+ORDER BY id DESC
+LIMIT 1;
+`
+	reasonSeparator = "\n"
+)
+
+// LastCoverage selects the coverage of the last action received
+// for a service, leaving out the actions of local runs and the
+// actions without coverage. It returns nil if the service has none
+func (s *StatsDB) LastCoverage(service string) *Payload {
+	var id int64
+	payload := &Payload{ServiceName: service}
+	err := s.lastRemoteStmt.QueryRow(service).Scan(&id, &payload.Coverage)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   lastRemoteSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	payload.Packages = s.GetPackageCoverage(id)
+	return payload
+}
+
+// SaveVerdict inserts a verdict into the verdict table
+func (s *StatsDB) SaveVerdict(verdict *Verdict) error {
+	_, err := s.createVerdictStmt.Exec(verdict.ActionID,
+		verdict.ServiceName,
+		verdict.Passed,
+		strings.Join(verdict.Reasons, reasonSeparator))
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   createVerdictSQL,
+		}).Info("Sql error")
+		return err
+	}
+	return nil
+}
+
+// GetVerdict selects the last verdict of a service.
+// It returns nil if the service has none
+func (s *StatsDB) GetVerdict(service string) *Verdict {
+	verdict := &Verdict{}
+	var reasons string
+	err := s.selectVerdictStmt.QueryRow(service).Scan(&verdict.ActionID,
+		&verdict.ServiceName,
+		&verdict.Passed,
+		&reasons)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   selectVerdictSQL,
+		}).Info("Sql error")
+		return nil
+	}
+	verdict.Reasons = []string{}
+	if reasons != "" {
+		verdict.Reasons = strings.Split(reasons, reasonSeparator)
+	}
+	return verdict
+}
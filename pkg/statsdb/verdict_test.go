@@ -0,0 +1,91 @@
+package statsdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestStatsDB_GetVerdict checks if the last verdict of a service
+// is returned
+func TestStatsDB_GetVerdict(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	verdicts := []*Verdict{
+		{ActionID: 1, ServiceName: "test", Passed: false, Reasons: []string{"a", "b"}},
+		{ActionID: 2, ServiceName: "test", Passed: true, Reasons: []string{}},
+		{ActionID: 3, ServiceName: "other", Passed: false, Reasons: []string{"c"}},
+	}
+	for _, verdict := range verdicts {
+		if err := stats.SaveVerdict(verdict); err != nil {
+			t.Errorf("StatsDB.SaveVerdict(): want: %v, got: %v", nil, err)
+			return
+		}
+	}
+
+	testCases := []struct {
+		service string
+		want    *Verdict
+	}{
+		{service: "test", want: verdicts[1]},
+		{service: "other", want: verdicts[2]},
+		{service: "unknown", want: nil},
+	}
+
+	for _, tc := range testCases {
+		got := stats.GetVerdict(tc.service)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("StatsDB.GetVerdict(%q): want: %v, got: %v", tc.service, tc.want, got)
+		}
+	}
+}
+
+// TestStatsDB_LastCoverage checks if the coverage of the last action
+// received for a service leaves out local runs and actions without coverage
+func TestStatsDB_LastCoverage(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	if got := stats.LastCoverage("test"); got != nil {
+		t.Errorf("StatsDB.LastCoverage(): want: %v, got: %v", nil, got)
+	}
+
+	remote := &GitHubAction{Payload: &Payload{
+		ServiceName: "test",
+		Coverage:    42,
+		Packages:    []PackageCoverage{{Package: "ringier/pkg/statsdb", Coverage: 60}},
+	}}
+	if err := stats.Save(remote); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+	local := &GitHubAction{TriggerID: remote.ID, Payload: &Payload{ServiceName: "test", Coverage: 10}}
+	if err := stats.Save(local); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+	webhook := &GitHubAction{Event: "workflow_run", Payload: &Payload{ServiceName: "test", NoCoverage: true}}
+	if err := stats.Save(webhook); err != nil {
+		t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+		return
+	}
+	if all := stats.GetAllActions(); len(all) != 3 || !all[2].Payload.NoCoverage || all[0].Payload.NoCoverage {
+		t.Errorf("StatsDB.GetAllActions(): want: the webhook without coverage, got: %v", all)
+	}
+
+	got := stats.LastCoverage("test")
+	if got == nil || got.Coverage != 42 || !reflect.DeepEqual(got.Packages, remote.Payload.Packages) {
+		t.Errorf("StatsDB.LastCoverage(): want: %v, got: %v", remote.Payload, got)
+	}
+}
@@ -0,0 +1,106 @@
+package statsdb
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WorkflowRun structure of the GitHub workflow run or check suite
+// an action was received from
+type WorkflowRun struct {
+	ActionID   int64  `json:"action_id"`
+	RunID      int64  `json:"run_id"`
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	HeadSHA    string `json:"head_sha"`
+	Workflow   string `json:"workflow"`
+	Conclusion string `json:"conclusion"`
+	RunURL     string `json:"run_url"`
+}
+
+// String formats the workflow run for the web page
+func (w *WorkflowRun) String() string {
+	if w == nil {
+		return ""
+	}
+	sha := w.HeadSHA
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	return fmt.Sprintf("%s %s@%s %s: %s", w.Repository, w.Branch, sha, w.Workflow, w.Conclusion)
+}
+
+const (
+	createWorkflowSQL = `INSERT INTO workflow_run (
+	action_id,run_id,repository,branch,head_sha,workflow,conclusion,run_url)
+	VALUES(?,?,?,?,?,?,?,?);
+`
+)
+
+// saveWorkflowRun inserts the workflow run of an action
+// into the workflow_run table
+func (s *StatsDB) saveWorkflowRun(tx *sql.Tx, actionID int64, run *WorkflowRun) error {
+	if run == nil {
+		return nil
+	}
+	run.ActionID = actionID
+	_, err := tx.Stmt(s.createWorkflowStmt).Exec(actionID,
+		run.RunID,
+		run.Repository,
+		run.Branch,
+		run.HeadSHA,
+		run.Workflow,
+		run.Conclusion,
+		run.RunURL)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"sql":   createWorkflowSQL,
+		}).Info("Sql error")
+		return err
+	}
+	return nil
+}
+
+// workflowColumns structure of the nullable workflow_run
+// columns joined to an action
+type workflowColumns struct {
+	RunID      sql.NullInt64
+	Repository sql.NullString
+	Branch     sql.NullString
+	HeadSHA    sql.NullString
+	Workflow   sql.NullString
+	Conclusion sql.NullString
+	RunURL     sql.NullString
+}
+
+// dest returns the scan destinations of the columns
+func (c *workflowColumns) dest() []interface{} {
+	return []interface{}{&c.RunID,
+		&c.Repository,
+		&c.Branch,
+		&c.HeadSHA,
+		&c.Workflow,
+		&c.Conclusion,
+		&c.RunURL}
+}
+
+// run returns the workflow run of an action
+// or nil if it has none
+func (c *workflowColumns) run(actionID int64) *WorkflowRun {
+	if !c.RunID.Valid {
+		return nil
+	}
+	return &WorkflowRun{
+		ActionID:   actionID,
+		RunID:      c.RunID.Int64,
+		Repository: c.Repository.String,
+		Branch:     c.Branch.String,
+		HeadSHA:    c.HeadSHA.String,
+		Workflow:   c.Workflow.String,
+		Conclusion: c.Conclusion.String,
+		RunURL:     c.RunURL.String,
+	}
+}
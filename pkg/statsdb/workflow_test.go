@@ -0,0 +1,47 @@
+package statsdb
+
+import (
+	"os"
+	"testing"
+)
+
+// TestStatsDB_SaveWorkflowRun checks if the workflow run of an action
+// is stored and read back with it
+func TestStatsDB_SaveWorkflowRun(t *testing.T) {
+	os.Remove("./test.db")
+	stats := Open("./test.db")
+	err := stats.Setup()
+	if err != nil {
+		t.Errorf("StatsDB.StatsDB(): Failed to setup database")
+		return
+	}
+
+	run := &WorkflowRun{RunID: 42, Repository: "octo-org/octo-repo", Branch: "main",
+		HeadSHA: "acb5820ced9479c074f688cc328bf03f341a511d", Workflow: "Build",
+		Conclusion: "success", RunURL: "https://github.com/octo-org/octo-repo/actions/runs/42"}
+	actions := []*GitHubAction{
+		{Event: "workflow_run", Payload: &Payload{ServiceName: "octo-repo"}, Workflow: run},
+		{Event: "push", Payload: &Payload{ServiceName: "octo-repo"}},
+	}
+	for _, action := range actions {
+		if err := stats.Save(action); err != nil {
+			t.Errorf("StatsDB.Save(): want: %v, got: %v", nil, err)
+			return
+		}
+	}
+
+	got := stats.GetAllActions()
+	if len(got) != 2 {
+		t.Errorf("StatsDB.GetAllActions(): want: %v actions, got: %v", 2, len(got))
+		return
+	}
+	if got[0].Workflow == nil || *got[0].Workflow != *run {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", run, got[0].Workflow)
+	}
+	if got[1].Workflow != nil {
+		t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", nil, got[1].Workflow)
+	}
+	if want := "octo-org/octo-repo main@acb5820 Build: success"; run.String() != want {
+		t.Errorf("WorkflowRun.String(): want: %q, got: %q", want, run.String())
+	}
+}
@@ -0,0 +1,169 @@
+package trackerapi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"ringier/pkg/statsdb"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// profileBlock structure of a block of a go coverprofile
+type profileBlock struct {
+	File       string
+	Range      string
+	Statements int
+	Count      int
+}
+
+// parseCoverProfile computes the statement coverage of every file
+// found in a go coverprofile
+func parseCoverProfile(r io.Reader) ([]statsdb.FileCoverage, error) {
+	blocks := map[string]*profileBlock{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		block, err := parseProfileBlock(line)
+		if err != nil {
+			return nil, err
+		}
+		// profiles merged from several packages repeat their blocks
+		key := block.File + ":" + block.Range
+		if seen, ok := blocks[key]; ok {
+			seen.Count += block.Count
+			continue
+		}
+		blocks[key] = block
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	byFile := map[string]*statsdb.FileCoverage{}
+	for _, block := range blocks {
+		file, ok := byFile[block.File]
+		if !ok {
+			file = &statsdb.FileCoverage{File: block.File}
+			byFile[block.File] = file
+		}
+		file.Statements += block.Statements
+		if block.Count > 0 {
+			file.Covered += block.Statements
+		}
+	}
+
+	files := []statsdb.FileCoverage{}
+	for _, file := range byFile {
+		file.Coverage = percent(file.Covered, file.Statements)
+		files = append(files, *file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].File < files[j].File })
+	return files, nil
+}
+
+// parseProfileBlock parses a line of a coverprofile formatted as
+// name.go:line.column,line.column numberOfStatements count
+func parseProfileBlock(line string) (*profileBlock, error) {
+	colon := strings.LastIndex(line, ":")
+	if colon == -1 {
+		return nil, fmt.Errorf("bad coverprofile line: %q", line)
+	}
+	fields := strings.Fields(line[colon+1:])
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("bad coverprofile line: %q", line)
+	}
+	statements, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("bad statement count in coverprofile line: %q", line)
+	}
+	count, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("bad count in coverprofile line: %q", line)
+	}
+	return &profileBlock{
+		File:       line[:colon],
+		Range:      fields[0],
+		Statements: statements,
+		Count:      count,
+	}, nil
+}
+
+// coverFuncs runs go tool cover on a coverprofile to get
+// the coverage of every function
+func coverFuncs(cfg TestConfig, profile string) []statsdb.FuncCoverage {
+	cmd := exec.Command(cfg.Command, "tool", "cover", "-func="+profile)
+	cmd.Dir = cfg.Dir
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":  err,
+			"stderr": stderr.String(),
+		}).Info("Error running cover command")
+		return nil
+	}
+	return parseCoverFuncs(out.Bytes())
+}
+
+// parseCoverFuncs parses the output of go tool cover -func
+// formatted as name.go:line:	function	coverage%
+func parseCoverFuncs(out []byte) []statsdb.FuncCoverage {
+	funcs := []statsdb.FuncCoverage{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] == "total:" {
+			continue
+		}
+		location := strings.Split(strings.TrimSuffix(fields[0], ":"), ":")
+		if len(location) < 2 {
+			continue
+		}
+		line, err := strconv.Atoi(location[len(location)-1])
+		if err != nil {
+			continue
+		}
+		coverage, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 64)
+		if err != nil {
+			continue
+		}
+		funcs = append(funcs, statsdb.FuncCoverage{
+			File:     strings.Join(location[:len(location)-1], ":"),
+			Line:     line,
+			Function: fields[1],
+			Coverage: coverage,
+		})
+	}
+	return funcs
+}
+
+// totalCoverage computes the statement coverage of a set of files
+func totalCoverage(files []statsdb.FileCoverage) float64 {
+	statements, covered := 0, 0
+	for _, file := range files {
+		statements += file.Statements
+		covered += file.Covered
+	}
+	return percent(covered, statements)
+}
+
+// percent computes the percentage of part over whole
+// rounded to one decimal like go test does
+func percent(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(int(float64(part)*1000/float64(whole)+0.5)) / 10
+}
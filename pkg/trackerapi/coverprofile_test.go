@@ -0,0 +1,77 @@
+package trackerapi
+
+import (
+	"reflect"
+	"ringier/pkg/statsdb"
+	"strings"
+	"testing"
+)
+
+var coverProfile string = `mode: set
+ringier/pkg/statsdb/sqllite.go:66.39,68.16 2 1
+ringier/pkg/statsdb/sqllite.go:68.16,73.3 1 0
+ringier/pkg/statsdb/sqllite.go:75.2,78.4 1 1
+ringier/pkg/trackerapi/tracker_api.go:40.70,44.16 3 0
+ringier/pkg/trackerapi/tracker_api.go:40.70,44.16 3 1
+ringier/pkg/trackerapi/tracker_api.go:52.2,58.3 1 0
+`
+
+// TestTrackerApi_parseCoverProfile checks if the statement coverage
+// of every file is computed from a coverprofile
+func TestTrackerApi_parseCoverProfile(t *testing.T) {
+	got, err := parseCoverProfile(strings.NewReader(coverProfile))
+	if err != nil {
+		t.Errorf("parseCoverProfile(): want: %v, got: %v", nil, err)
+		return
+	}
+	want := []statsdb.FileCoverage{
+		{File: "ringier/pkg/statsdb/sqllite.go", Statements: 4, Covered: 3, Coverage: 75.0},
+		{File: "ringier/pkg/trackerapi/tracker_api.go", Statements: 4, Covered: 3, Coverage: 75.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCoverProfile(): want: %v, got: %v", want, got)
+	}
+	if total := totalCoverage(got); total != 75.0 {
+		t.Errorf("totalCoverage(): want: %v, got: %v", 75.0, total)
+	}
+
+	if _, err := parseCoverProfile(strings.NewReader("mode: set\nbroken line\n")); err == nil {
+		t.Errorf("parseCoverProfile(%q): want: an error, got: %v", "broken line", err)
+	}
+}
+
+// TestTrackerApi_parseCoverFuncs checks if the coverage of every
+// function is parsed from go tool cover -func
+func TestTrackerApi_parseCoverFuncs(t *testing.T) {
+	out := []byte("ringier/pkg/statsdb/sqllite.go:66:\tOpen\t\t100.0%\n" +
+		"ringier/pkg/statsdb/sqllite.go:81:\tSetup\t\t62.5%\n" +
+		"total:\t\t\t\t(statements)\t75.0%\n")
+	want := []statsdb.FuncCoverage{
+		{File: "ringier/pkg/statsdb/sqllite.go", Line: 66, Function: "Open", Coverage: 100.0},
+		{File: "ringier/pkg/statsdb/sqllite.go", Line: 81, Function: "Setup", Coverage: 62.5},
+	}
+
+	got := parseCoverFuncs(out)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCoverFuncs(): want: %v, got: %v", want, got)
+	}
+}
+
+// TestTrackerApi_percent checks the rounding of coverage percentages
+func TestTrackerApi_percent(t *testing.T) {
+	testCases := []struct {
+		part  int
+		whole int
+		want  float64
+	}{
+		{part: 1, whole: 3, want: 33.3},
+		{part: 2, whole: 3, want: 66.7},
+		{part: 0, whole: 0, want: 0},
+	}
+
+	for _, tc := range testCases {
+		if got := percent(tc.part, tc.whole); got != tc.want {
+			t.Errorf("percent(%d, %d): want: %v, got: %v", tc.part, tc.whole, tc.want, got)
+		}
+	}
+}
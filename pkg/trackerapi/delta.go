@@ -0,0 +1,55 @@
+package trackerapi
+
+import (
+	"ringier/pkg/statsdb"
+	"sort"
+)
+
+// coverageDelta compares the coverage of a remote action with the
+// local actions of the run it triggered, the last one being the
+// module total. Packages are only compared when the remote action
+// reports them
+func coverageDelta(remote *statsdb.GitHubAction, locals []*statsdb.GitHubAction) *statsdb.CoverageDelta {
+	if len(locals) == 0 {
+		return nil
+	}
+	total := locals[len(locals)-1]
+	delta := &statsdb.CoverageDelta{
+		ActionID:       remote.ID,
+		LocalID:        total.ID,
+		RemoteCoverage: remote.Payload.Coverage,
+		LocalCoverage:  total.Payload.Coverage,
+		Delta:          round(total.Payload.Coverage - remote.Payload.Coverage),
+	}
+	if len(remote.Payload.Packages) == 0 {
+		return delta
+	}
+
+	remotePackages := map[string]bool{}
+	for _, pkg := range remote.Payload.Packages {
+		remotePackages[pkg.Package] = true
+	}
+	localPackages := map[string]bool{}
+	for _, local := range locals[:len(locals)-1] {
+		localPackages[local.Event] = true
+		if !remotePackages[local.Event] {
+			delta.LocalOnly = append(delta.LocalOnly, local.Event)
+		}
+	}
+	for pkg := range remotePackages {
+		if !localPackages[pkg] {
+			delta.RemoteOnly = append(delta.RemoteOnly, pkg)
+		}
+	}
+	sort.Strings(delta.RemoteOnly)
+	sort.Strings(delta.LocalOnly)
+	return delta
+}
+
+// round rounds a coverage difference to one decimal
+func round(v float64) float64 {
+	if v < 0 {
+		return -float64(int(-v*10+0.5)) / 10
+	}
+	return float64(int(v*10+0.5)) / 10
+}
@@ -0,0 +1,56 @@
+package trackerapi
+
+import (
+	"reflect"
+	"ringier/pkg/statsdb"
+	"testing"
+)
+
+// TestTrackerApi_coverageDelta checks if a remote action is compared
+// with the local run it triggered
+func TestTrackerApi_coverageDelta(t *testing.T) {
+	locals := []*statsdb.GitHubAction{
+		{ID: 2, Event: "ringier/pkg/statsdb", Payload: &statsdb.Payload{Coverage: 60}},
+		{ID: 3, Event: "ringier/pkg/trackerapi", Payload: &statsdb.Payload{Coverage: 40}},
+		{ID: 4, Event: "ringier", Payload: &statsdb.Payload{Coverage: 50}},
+	}
+
+	testCases := []struct {
+		remote *statsdb.GitHubAction
+		locals []*statsdb.GitHubAction
+		want   *statsdb.CoverageDelta
+	}{
+		{
+			remote: &statsdb.GitHubAction{ID: 1, Payload: &statsdb.Payload{Coverage: 52.3}},
+			locals: locals,
+			want: &statsdb.CoverageDelta{ActionID: 1, LocalID: 4,
+				RemoteCoverage: 52.3, LocalCoverage: 50, Delta: -2.3},
+		},
+		{
+			remote: &statsdb.GitHubAction{ID: 1, Payload: &statsdb.Payload{
+				Coverage: 45,
+				Packages: []statsdb.PackageCoverage{
+					{Package: "ringier/pkg/statsdb", Coverage: 60},
+					{Package: "ringier/cmd/tracker", Coverage: 30},
+				},
+			}},
+			locals: locals,
+			want: &statsdb.CoverageDelta{ActionID: 1, LocalID: 4,
+				RemoteCoverage: 45, LocalCoverage: 50, Delta: 5,
+				RemoteOnly: []string{"ringier/cmd/tracker"},
+				LocalOnly:  []string{"ringier/pkg/trackerapi"}},
+		},
+		{
+			remote: &statsdb.GitHubAction{ID: 1, Payload: &statsdb.Payload{Coverage: 45}},
+			locals: nil,
+			want:   nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		got := coverageDelta(tc.remote, tc.locals)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("coverageDelta(): want: %v, got: %v", tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package trackerapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"ringier/pkg/statsdb"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+
+	contentJSON   = "application/json"
+	contentNDJSON = "application/x-ndjson"
+	contentCSV    = "text/csv"
+
+	flushRows = 100
+)
+
+// exportColumn structure of a column of the exported actions
+type exportColumn struct {
+	Name  string
+	Value func(*statsdb.GitHubAction) interface{}
+}
+
+// exportColumns the columns which can be selected for an export,
+// a CSV export without selection has all of them
+var exportColumns = []exportColumn{
+	{"id", func(a *statsdb.GitHubAction) interface{} { return a.ID }},
+	{"event", func(a *statsdb.GitHubAction) interface{} { return a.Event }},
+	{"venture_config_id", func(a *statsdb.GitHubAction) interface{} { return a.VentureConfigId }},
+	{"venture_reference", func(a *statsdb.GitHubAction) interface{} { return a.VentureReference }},
+	{"created_at", func(a *statsdb.GitHubAction) interface{} { return a.CreatedAt }},
+	{"received_at", func(a *statsdb.GitHubAction) interface{} { return a.ReceivedAt }},
+	{"culture", func(a *statsdb.GitHubAction) interface{} { return a.Culture }},
+	{"action_type", func(a *statsdb.GitHubAction) interface{} { return a.ActionType }},
+	{"action_reference", func(a *statsdb.GitHubAction) interface{} { return a.ActionReference }},
+	{"version", func(a *statsdb.GitHubAction) interface{} { return a.Version }},
+	{"route", func(a *statsdb.GitHubAction) interface{} { return a.Route }},
+	{"repository", func(a *statsdb.GitHubAction) interface{} { return a.Repository }},
+	{"branch", func(a *statsdb.GitHubAction) interface{} { return a.Branch }},
+	{"commit_sha", func(a *statsdb.GitHubAction) interface{} { return a.CommitSHA }},
+	{"pull_request", func(a *statsdb.GitHubAction) interface{} { return a.PullRequest }},
+	{"author", func(a *statsdb.GitHubAction) interface{} { return a.Author }},
+	{"service_name", func(a *statsdb.GitHubAction) interface{} { return a.Payload.ServiceName }},
+	{"coverage", func(a *statsdb.GitHubAction) interface{} {
+		if a.Payload.NoCoverage {
+			return nil
+		}
+		return a.Payload.Coverage
+	}},
+	{"status", func(a *statsdb.GitHubAction) interface{} { return a.Payload.Status }},
+	{"exit_code", func(a *statsdb.GitHubAction) interface{} { return a.Payload.ExitCode }},
+	{"trigger_id", func(a *statsdb.GitHubAction) interface{} { return a.TriggerID }},
+	{"delta", func(a *statsdb.GitHubAction) interface{} {
+		if a.Delta == nil {
+			return nil
+		}
+		return a.Delta.Delta
+	}},
+	{"head_sha", func(a *statsdb.GitHubAction) interface{} {
+		if a.Workflow == nil {
+			return nil
+		}
+		return a.Workflow.HeadSHA
+	}},
+	{"tests", func(a *statsdb.GitHubAction) interface{} {
+		if a.TestSummary == nil {
+			return nil
+		}
+		return a.TestSummary.Tests
+	}},
+	{"failed", func(a *statsdb.GitHubAction) interface{} {
+		if a.TestSummary == nil {
+			return nil
+		}
+		return a.TestSummary.Failed
+	}},
+}
+
+// payloadColumn returns the column of a key of the raw payload,
+// an action without the key has an empty value
+func payloadColumn(name string) exportColumn {
+	key := strings.TrimPrefix(name, payloadPrefix)
+	return exportColumn{name, func(a *statsdb.GitHubAction) interface{} {
+		return statsdb.PayloadValue(a.Raw, key)
+	}}
+}
+
+// selectColumns returns the export columns named in a comma
+// separated list, nil for an empty list. A payload.<key> name
+// selects the value of the key in the raw payload
+func selectColumns(fields string) ([]exportColumn, error) {
+	if fields == "" {
+		return nil, nil
+	}
+	columns := []exportColumn{}
+	for _, name := range strings.Split(fields, ",") {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, payloadPrefix) {
+			if err := statsdb.ValidatePayloadKey(strings.TrimPrefix(name, payloadPrefix)); err != nil {
+				return nil, fmt.Errorf("bad field %q", name)
+			}
+			columns = append(columns, payloadColumn(name))
+			continue
+		}
+		found := false
+		for _, column := range exportColumns {
+			if column.Name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// exportFormat returns the format of the exported actions taken from
+// the format query parameter or negotiated with the Accept header
+func exportFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format {
+		case formatJSON, formatNDJSON, formatCSV:
+			return format, nil
+		}
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case contentJSON:
+			return formatJSON, nil
+		case contentNDJSON, "application/jsonl":
+			return formatNDJSON, nil
+		case contentCSV:
+			return formatCSV, nil
+		}
+	}
+	return formatJSON, nil
+}
+
+// actionWriter writes actions one by one to a response
+type actionWriter interface {
+	Write(action *statsdb.GitHubAction) error
+	Flush() error
+	Close() error
+}
+
+// newActionWriter creates the writer of a format with the selected
+// columns, all of the action is written in JSON without selection
+func newActionWriter(w io.Writer, format string, columns []exportColumn) actionWriter {
+	switch format {
+	case formatNDJSON:
+		return &jsonWriter{w: w, columns: columns, separator: "\n"}
+	case formatCSV:
+		if columns == nil {
+			columns = exportColumns
+		}
+		return &csvWriter{w: csv.NewWriter(w), columns: columns}
+	}
+	return &jsonWriter{w: w, columns: columns, array: true, separator: ","}
+}
+
+// contentType returns the content type of a format
+func contentType(format string) string {
+	switch format {
+	case formatNDJSON:
+		return contentNDJSON
+	case formatCSV:
+		return contentCSV + "; charset=utf-8"
+	}
+	return contentJSON
+}
+
+// exportRow the selected columns of an action, written as
+// a JSON object with the fields in the order of the columns
+type exportRow struct {
+	columns []exportColumn
+	action  *statsdb.GitHubAction
+}
+
+// MarshalJSON writes the columns of the row in order
+func (e exportRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range e.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(column.Value(e.action))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonWriter writes actions as a JSON array or as lines of JSON
+type jsonWriter struct {
+	w         io.Writer
+	columns   []exportColumn
+	array     bool
+	separator string
+	count     int
+}
+
+// Write writes an action
+func (j *jsonWriter) Write(action *statsdb.GitHubAction) error {
+	var v interface{} = action
+	if j.columns != nil {
+		v = exportRow{columns: j.columns, action: action}
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	switch {
+	case j.array && j.count == 0:
+		prefix = "["
+	case j.array:
+		prefix = j.separator
+	}
+	if !j.array {
+		buf = append(buf, j.separator...)
+	}
+	j.count++
+	_, err = io.WriteString(j.w, prefix+string(buf))
+	return err
+}
+
+// Flush does nothing as the actions are not buffered
+func (j *jsonWriter) Flush() error {
+	return nil
+}
+
+// Close ends the JSON array
+func (j *jsonWriter) Close() error {
+	if !j.array {
+		return nil
+	}
+	end := "]"
+	if j.count == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// csvWriter writes actions as CSV records after a header
+type csvWriter struct {
+	w       *csv.Writer
+	columns []exportColumn
+	started bool
+}
+
+// header writes the names of the columns once
+func (c *csvWriter) header() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	names := []string{}
+	for _, column := range c.columns {
+		names = append(names, column.Name)
+	}
+	return c.w.Write(names)
+}
+
+// Write writes an action
+func (c *csvWriter) Write(action *statsdb.GitHubAction) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	record := []string{}
+	for _, column := range c.columns {
+		record = append(record, csvValue(column.Value(action)))
+	}
+	return c.w.Write(record)
+}
+
+// Flush writes the buffered records
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Close flushes the records
+func (c *csvWriter) Close() error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvValue formats a value of a CSV record
+func csvValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case time.Time:
+		return value.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,148 @@
+package trackerapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"ringier/pkg/statsdb"
+	"strings"
+	"testing"
+)
+
+// TestTrackerApi_exportFormat checks the negotiation of the format
+func TestTrackerApi_exportFormat(t *testing.T) {
+	testCases := []struct {
+		query  string
+		accept string
+		want   string
+		err    bool
+	}{
+		{want: formatJSON},
+		{accept: "text/html, */*", want: formatJSON},
+		{accept: "text/csv; charset=utf-8", want: formatCSV},
+		{accept: "application/x-ndjson", want: formatNDJSON},
+		{query: "format=csv", accept: "application/json", want: formatCSV},
+		{query: "format=xml", err: true},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/api/stats?"+tc.query, nil)
+		r.Header.Set("Accept", tc.accept)
+		got, err := exportFormat(r)
+		if got != tc.want || (err != nil) != tc.err {
+			t.Errorf("exportFormat(%q, %q): want: %v error %v, got: %v %v", tc.query, tc.accept, tc.want, tc.err, got, err)
+		}
+	}
+}
+
+// TestTrackerApi_StatsAPIExport checks the formats and the columns
+// of the actions written by the api endpoint
+func TestTrackerApi_StatsAPIExport(t *testing.T) {
+	tracker := &Tracker{}
+	tracker.DB = statsdb.NewMemStore()
+	for _, action := range []*statsdb.GitHubAction{
+		{Event: "push", Payload: &statsdb.Payload{ServiceName: "shop", Coverage: 23.5}, Raw: json.RawMessage(`{"runner":"linux"}`)},
+		{Event: "push, again", Payload: &statsdb.Payload{ServiceName: "search", Coverage: 70}},
+	} {
+		if err := tracker.DB.Save(action); err != nil {
+			t.Errorf("Error saving action: %v", err)
+			return
+		}
+	}
+
+	testCases := []struct {
+		query       string
+		want        int
+		contentType string
+		body        string
+	}{
+		{query: "format=csv&fields=id,service_name,coverage,event", want: http.StatusOK, contentType: "text/csv; charset=utf-8",
+			body: "id,service_name,coverage,event\n1,shop,23.5,push\n2,search,70,\"push, again\"\n"},
+		{query: "format=csv&fields=id&service=none", want: http.StatusOK, contentType: "text/csv; charset=utf-8", body: "id\n"},
+		{query: "format=ndjson&fields=id,coverage", want: http.StatusOK, contentType: contentNDJSON,
+			body: "{\"id\":1,\"coverage\":23.5}\n{\"id\":2,\"coverage\":70}\n"},
+		{query: "fields=service_name,id,payload.runner", want: http.StatusOK, contentType: contentJSON,
+			body: `[{"service_name":"shop","id":1,"payload.runner":"linux"},{"service_name":"search","id":2,"payload.runner":""}]`},
+		{query: "fields=service_name&sort=-id", want: http.StatusOK, contentType: contentJSON,
+			body: `[{"service_name":"search"},{"service_name":"shop"}]`},
+		{query: "fields=id&limit=1", want: http.StatusOK, contentType: contentJSON, body: `[{"id":1}]`},
+		{query: "service=none", want: http.StatusOK, contentType: contentJSON, body: `[]`},
+		{query: "format=csv&fields=id,payload.runner", want: http.StatusOK, contentType: "text/csv; charset=utf-8",
+			body: "id,payload.runner\n1,linux\n2,\n"},
+		{query: "fields=password", want: http.StatusBadRequest},
+		{query: "fields=payload.", want: http.StatusBadRequest},
+		{query: "format=xml", want: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		tracker.StatsAPI(w, httptest.NewRequest(http.MethodGet, "/api/stats?"+tc.query, nil))
+		resp := w.Result()
+		if resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.StatsAPI(%q): want: %v, got: %v", tc.query, tc.want, resp.StatusCode)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if got := resp.Header.Get("Content-Type"); got != tc.contentType {
+			t.Errorf("trackerapi.StatsAPI(%q): want: %v, got: %v", tc.query, tc.contentType, got)
+		}
+		if string(body) != tc.body {
+			t.Errorf("trackerapi.StatsAPI(%q): want: %q, got: %q", tc.query, tc.body, string(body))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	tracker.StatsAPI(w, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	actions := []statsdb.GitHubAction{}
+	if err := json.NewDecoder(w.Result().Body).Decode(&actions); err != nil || len(actions) != 2 || actions[1].Payload.ServiceName != "search" {
+		t.Errorf("trackerapi.StatsAPI(): want: %v actions, got: %v %v", 2, actions, err)
+	}
+
+	all := []string{}
+	for _, column := range exportColumns {
+		all = append(all, column.Name)
+	}
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+	r.Header.Set("Accept", contentCSV)
+	tracker.StatsAPI(w, r)
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	if lines := strings.Split(string(body), "\n"); len(lines) != 4 || lines[0] != strings.Join(all, ",") {
+		t.Errorf("trackerapi.StatsAPI(csv): want: a header and %v records, got: %q", 2, string(body))
+	}
+}
+
+// TestTrackerApi_writeActions checks if an error before the first
+// row is told by the status and an error after it truncates the rows
+func TestTrackerApi_writeActions(t *testing.T) {
+	testCases := []struct {
+		rows int
+		want int
+		body string
+	}{
+		{rows: 0, want: http.StatusInternalServerError, body: ""},
+		{rows: 1, want: http.StatusOK, body: `[{"id":1}`},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		writeActions(w, formatJSON, []exportColumn{exportColumns[0]}, func(fn func(*statsdb.GitHubAction) error) error {
+			for i := 1; i <= tc.rows; i++ {
+				if err := fn(&statsdb.GitHubAction{ID: int64(i), Payload: &statsdb.Payload{}}); err != nil {
+					return err
+				}
+			}
+			return errors.New("connection lost")
+		})
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != tc.want || string(body) != tc.body {
+			t.Errorf("writeActions(%d rows): want: %v %q, got: %v %q", tc.rows, tc.want, tc.body, resp.StatusCode, string(body))
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package trackerapi
+
+import (
+	"math"
+	"net/http"
+	"ringier/pkg/statsdb"
+	"sort"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultFlakyWindow = 20
+
+// FlakyTest structure of a test whose outcome flips across runs
+type FlakyTest struct {
+	ServiceName  string  `json:"service_name"`
+	Package      string  `json:"package"`
+	Name         string  `json:"name"`
+	Runs         int     `json:"runs"`
+	Failures     int     `json:"failures"`
+	Flips        int     `json:"flips"`
+	FlakyCommits int     `json:"flaky_commits"`
+	Score        float64 `json:"score"`
+}
+
+// testHistory outcomes of a test from the oldest run
+type testHistory struct {
+	test     FlakyTest
+	statuses []string
+	commits  []string
+}
+
+// flakyTests scores how flaky every test is over its last runs.
+// The score is the share of consecutive runs in the window whose
+// outcome flips, raised to the share of commits on which the test
+// both passed and failed. Tests which never flip are left out
+func flakyTests(outcomes []statsdb.TestOutcome, window int) []FlakyTest {
+	if window < 2 {
+		window = defaultFlakyWindow
+	}
+	histories := map[string]*testHistory{}
+	keys := []string{}
+	for _, outcome := range outcomes {
+		key := outcome.ServiceName + "\x00" + outcome.Package + "\x00" + outcome.Name
+		history, ok := histories[key]
+		if !ok {
+			history = &testHistory{test: FlakyTest{
+				ServiceName: outcome.ServiceName,
+				Package:     outcome.Package,
+				Name:        outcome.Name,
+			}}
+			histories[key] = history
+			keys = append(keys, key)
+		}
+		status := statusPass
+		if outcome.Status != statusPass {
+			status = statusFail
+		}
+		history.statuses = append(history.statuses, status)
+		history.commits = append(history.commits, outcome.Commit)
+	}
+
+	flaky := []FlakyTest{}
+	for _, key := range keys {
+		history := histories[key]
+		if len(history.statuses) > window {
+			history.statuses = history.statuses[len(history.statuses)-window:]
+			history.commits = history.commits[len(history.commits)-window:]
+		}
+		test := history.test
+		test.Runs = len(history.statuses)
+
+		byCommit := map[string]map[string]bool{}
+		for i, status := range history.statuses {
+			if status == statusFail {
+				test.Failures++
+			}
+			if i > 0 && status != history.statuses[i-1] {
+				test.Flips++
+			}
+			if commit := history.commits[i]; commit != "" {
+				if byCommit[commit] == nil {
+					byCommit[commit] = map[string]bool{}
+				}
+				byCommit[commit][status] = true
+			}
+		}
+		for _, statuses := range byCommit {
+			if len(statuses) > 1 {
+				test.FlakyCommits++
+			}
+		}
+		if test.Flips == 0 && test.FlakyCommits == 0 {
+			continue
+		}
+
+		score := float64(test.Flips) / float64(test.Runs-1)
+		if len(byCommit) > 0 {
+			score = math.Max(score, float64(test.FlakyCommits)/float64(len(byCommit)))
+		}
+		test.Score = math.Round(score*100) / 100
+		flaky = append(flaky, test)
+	}
+
+	sort.SliceStable(flaky, func(i, j int) bool { return flaky[i].Score > flaky[j].Score })
+	return flaky
+}
+
+// flakyWindow returns the number of runs a test is scored over
+func (t *Tracker) flakyWindow() int {
+	if t.FlakyWindow < 2 {
+		return defaultFlakyWindow
+	}
+	return t.FlakyWindow
+}
+
+// FlakyAPI endpoint to the flaky tests
+// GET /api/flaky?service=name&window=runs
+func (t *Tracker) FlakyAPI(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("tracker.FlakyAPI")
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := t.flakyWindow()
+	if value := r.URL.Query().Get("window"); value != "" {
+		var err error
+		window, err = strconv.Atoi(value)
+		if err != nil || window < 2 {
+			logrus.WithFields(logrus.Fields{
+				"window": value,
+			}).Info("Error parsing the flaky window")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	outcomes := t.DB.GetTestOutcomes(r.URL.Query().Get("service"), window)
+	if outcomes == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, flakyTests(outcomes, window))
+}
@@ -0,0 +1,88 @@
+package trackerapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"ringier/pkg/statsdb"
+	"strings"
+	"testing"
+)
+
+// outcomes builds the outcomes of a test from a list of statuses
+// formatted as status or status@commit
+func outcomes(service, name string, runs ...string) []statsdb.TestOutcome {
+	list := []statsdb.TestOutcome{}
+	for i, run := range runs {
+		fields := strings.SplitN(run, "@", 2)
+		outcome := statsdb.TestOutcome{ActionID: int64(i + 1), ServiceName: service, Package: "pkg", Name: name, Status: fields[0]}
+		if len(fields) == 2 {
+			outcome.Commit = fields[1]
+		}
+		list = append(list, outcome)
+	}
+	return list
+}
+
+// TestTrackerApi_flakyTests checks the flakiness score of tests
+func TestTrackerApi_flakyTests(t *testing.T) {
+	testCases := []struct {
+		name     string
+		outcomes []statsdb.TestOutcome
+		window   int
+		want     []FlakyTest
+	}{
+		{name: "stable", outcomes: outcomes("shop", "TestA", "pass", "pass", "pass")},
+		{name: "broken", outcomes: outcomes("shop", "TestA", "fail", "error", "fail")},
+		{name: "fixed", outcomes: outcomes("shop", "TestA", "fail", "fail", "pass", "pass"), want: []FlakyTest{
+			{ServiceName: "shop", Package: "pkg", Name: "TestA", Runs: 4, Failures: 2, Flips: 1, Score: 0.33}}},
+		{name: "flipping", outcomes: outcomes("shop", "TestA", "pass", "fail", "pass", "fail", "pass"), want: []FlakyTest{
+			{ServiceName: "shop", Package: "pkg", Name: "TestA", Runs: 5, Failures: 2, Flips: 4, Score: 1}}},
+		{name: "window", outcomes: outcomes("shop", "TestA", "pass", "fail", "pass", "pass", "pass"), window: 3},
+		{name: "same commit", outcomes: outcomes("shop", "TestA", "pass@a", "pass@b", "fail@b", "fail@c", "fail@c"), want: []FlakyTest{
+			{ServiceName: "shop", Package: "pkg", Name: "TestA", Runs: 5, Failures: 3, Flips: 1, FlakyCommits: 1, Score: 0.33}}},
+		{name: "retried commit", outcomes: outcomes("shop", "TestA", "fail@a", "pass@a", "fail@b", "pass@b"), want: []FlakyTest{
+			{ServiceName: "shop", Package: "pkg", Name: "TestA", Runs: 4, Failures: 2, Flips: 3, FlakyCommits: 2, Score: 1}}},
+		{name: "ordered", outcomes: append(outcomes("shop", "TestA", "fail", "fail", "pass"), outcomes("search", "TestA", "pass", "fail", "pass")...), want: []FlakyTest{
+			{ServiceName: "search", Package: "pkg", Name: "TestA", Runs: 3, Failures: 1, Flips: 2, Score: 1},
+			{ServiceName: "shop", Package: "pkg", Name: "TestA", Runs: 3, Failures: 2, Flips: 1, Score: 0.5}}},
+	}
+
+	for _, tc := range testCases {
+		got := flakyTests(tc.outcomes, tc.window)
+		want := tc.want
+		if want == nil {
+			want = []FlakyTest{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("flakyTests(%s): want: %v, got: %v", tc.name, want, got)
+		}
+	}
+}
+
+// TestTrackerApi_FlakyAPI checks if the api endpoint
+// returns the flaky tests
+func TestTrackerApi_FlakyAPI(t *testing.T) {
+	tracker := &Tracker{}
+	tracker.DB = statsdb.NewMemStore()
+
+	testCases := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{method: http.MethodGet, path: "/api/flaky", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/flaky?service=shop&window=10", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/flaky?window=1", want: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/api/flaky?window=all", want: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/api/flaky", want: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		tracker.FlakyAPI(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if resp := w.Result(); resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.FlakyAPI(%s %q): want: %v, got: %v", tc.method, tc.path, tc.want, resp.StatusCode)
+		}
+	}
+}
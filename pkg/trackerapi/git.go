@@ -0,0 +1,79 @@
+package trackerapi
+
+import (
+	"os/exec"
+	"ringier/pkg/statsdb"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// gitSource structure of the checkout the local tests run in
+type gitSource struct {
+	Repository string
+	Branch     string
+	CommitSHA  string
+	Author     string
+}
+
+// readGitSource reads the repository, the branch, the commit and its
+// author of the git checkout in dir. What cannot be read is left empty
+func readGitSource(dir string) gitSource {
+	return gitSource{
+		Repository: repositoryName(git(dir, "config", "--get", "remote.origin.url")),
+		Branch:     branchName(git(dir, "rev-parse", "--abbrev-ref", "HEAD")),
+		CommitSHA:  git(dir, "rev-parse", "HEAD"),
+		Author:     git(dir, "log", "-1", "--format=%an"),
+	}
+}
+
+// git runs a git command in dir and returns its trimmed output,
+// an empty string when it fails
+func git(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"dir":   dir,
+			"args":  args,
+		}).Info("Error running git")
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// branchName returns the branch checked out, a detached
+// checkout has none
+func branchName(ref string) string {
+	if ref == "HEAD" {
+		return ""
+	}
+	return ref
+}
+
+// repositoryName returns the owner/name of a remote url like
+// git@github.com:ringier/tracker.git or https://github.com/ringier/tracker,
+// the way GitHub names the repository of its webhooks
+func repositoryName(url string) string {
+	url = strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	} else if i := strings.Index(url, ":"); i >= 0 {
+		url = url[:i] + "/" + url[i+1:]
+	}
+	fields := strings.Split(url, "/")
+	if len(fields) < 3 {
+		return url
+	}
+	return strings.Join(fields[len(fields)-2:], "/")
+}
+
+// apply sets the source of the checkout on an action
+func (g gitSource) apply(action *statsdb.GitHubAction) {
+	action.Repository = g.Repository
+	action.Branch = g.Branch
+	action.CommitSHA = g.CommitSHA
+	action.Author = g.Author
+}
@@ -0,0 +1,59 @@
+package trackerapi
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestTrackerApi_repositoryName(t *testing.T) {
+	testCases := []struct {
+		url  string
+		want string
+	}{
+		{url: "git@github.com:ringier/tracker.git", want: "ringier/tracker"},
+		{url: "https://github.com/ringier/tracker", want: "ringier/tracker"},
+		{url: "https://token@github.com/ringier/tracker.git/", want: "ringier/tracker"},
+		{url: "ssh://git@github.com/ringier/tracker.git", want: "ringier/tracker"},
+		{url: "", want: ""},
+	}
+	for _, tc := range testCases {
+		if got := repositoryName(tc.url); got != tc.want {
+			t.Errorf("repositoryName(%q): want: %v, got: %v", tc.url, tc.want, got)
+		}
+	}
+}
+
+// TestTrackerApi_readGitSource checks if the source of a checkout
+// is read and if a directory which is none has no source
+func TestTrackerApi_readGitSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker-git")
+	if err != nil {
+		t.Errorf("Error creating directory: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	if got := readGitSource(dir); got != (gitSource{}) {
+		t.Errorf("readGitSource(): want: %v, got: %v", gitSource{}, got)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"checkout", "-q", "-b", "main"},
+		{"remote", "add", "origin", "git@github.com:ringier/tracker.git"},
+		{"-c", "user.name=Octo Cat", "-c", "user.email=octo@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git %v: %v %s", args, err, out)
+		}
+	}
+
+	got := readGitSource(dir)
+	want := gitSource{Repository: "ringier/tracker", Branch: "main", CommitSHA: git(dir, "rev-parse", "HEAD"), Author: "Octo Cat"}
+	if got != want || len(got.CommitSHA) != 40 {
+		t.Errorf("readGitSource(): want: %v, got: %v", want, got)
+	}
+}
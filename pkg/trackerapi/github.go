@@ -0,0 +1,177 @@
+package trackerapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"ringier/pkg/statsdb"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	githubEventHeader  = "X-GitHub-Event"
+	githubSourceName   = "github"
+	githubWorkflowRun  = "workflow_run"
+	githubCheckSuite   = "check_suite"
+	githubPing         = "ping"
+	githubCompleted    = "completed"
+	githubActionType   = "github"
+	githubEventVersion = "1"
+)
+
+// githubRepository structure of the repository of a GitHub webhook
+type githubRepository struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+}
+
+// githubRun structure of the workflow run or check suite
+// of a GitHub webhook, they share the fields the tracker keeps
+type githubRun struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	HeadBranch string    `json:"head_branch"`
+	HeadSHA    string    `json:"head_sha"`
+	Status     string    `json:"status"`
+	Conclusion string    `json:"conclusion"`
+	HTMLURL    string    `json:"html_url"`
+	URL        string    `json:"url"`
+	CreatedAt  time.Time `json:"created_at"`
+	App        struct {
+		Name string `json:"name"`
+	} `json:"app"`
+	PullRequests []struct {
+		Number int `json:"number"`
+	} `json:"pull_requests"`
+	HeadCommit struct {
+		Author struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"head_commit"`
+}
+
+// githubWebhook structure of a workflow_run or check_suite webhook
+type githubWebhook struct {
+	Action      string           `json:"action"`
+	WorkflowRun *githubRun       `json:"workflow_run"`
+	CheckSuite  *githubRun       `json:"check_suite"`
+	Repository  githubRepository `json:"repository"`
+}
+
+// webhookAction maps a native GitHub webhook into an action
+// without coverage. It returns nil for the deliveries the tracker does not keep:
+// runs which are not completed yet and other events
+func webhookAction(event string, body []byte) (*statsdb.GitHubAction, error) {
+	webhook := &githubWebhook{}
+	if err := json.Unmarshal(body, webhook); err != nil {
+		return nil, err
+	}
+
+	var run *githubRun
+	workflow := ""
+	switch event {
+	case githubWorkflowRun:
+		run = webhook.WorkflowRun
+		if run != nil {
+			workflow = run.Name
+		}
+	case githubCheckSuite:
+		run = webhook.CheckSuite
+		if run != nil {
+			workflow = run.App.Name
+		}
+	}
+	if run == nil || webhook.Action != githubCompleted {
+		return nil, nil
+	}
+	runURL := run.HTMLURL
+	if runURL == "" {
+		runURL = run.URL
+	}
+	// a run of a pull request lists it, a run of a push has none
+	pullRequest := 0
+	if len(run.PullRequests) > 0 {
+		pullRequest = run.PullRequests[0].Number
+	}
+
+	return &statsdb.GitHubAction{
+		Event:           event,
+		CreatedAt:       run.CreatedAt,
+		ActionType:      githubActionType,
+		ActionReference: strconv.FormatInt(run.ID, 10),
+		Version:         githubEventVersion,
+		Route:           webhook.Repository.FullName,
+		Repository:      webhook.Repository.FullName,
+		Branch:          run.HeadBranch,
+		CommitSHA:       run.HeadSHA,
+		PullRequest:     pullRequest,
+		Author:          run.HeadCommit.Author.Name,
+		Payload: &statsdb.Payload{
+			ServiceName: webhook.Repository.Name,
+			Status:      conclusionStatus(run.Conclusion),
+			NoCoverage:  true,
+		},
+		Workflow: &statsdb.WorkflowRun{
+			RunID:      run.ID,
+			Repository: webhook.Repository.FullName,
+			Branch:     run.HeadBranch,
+			HeadSHA:    run.HeadSHA,
+			Workflow:   workflow,
+			Conclusion: run.Conclusion,
+			RunURL:     runURL,
+		},
+		Raw: json.RawMessage(body),
+	}, nil
+}
+
+// conclusionStatus maps the conclusion of a GitHub run
+// to the status of a test run
+func conclusionStatus(conclusion string) string {
+	switch conclusion {
+	case "success", "neutral":
+		return statusPass
+	case "failure", "timed_out", "action_required", "startup_failure":
+		return statusFail
+	case "cancelled", "skipped", "stale":
+		return statusSkip
+	}
+	return statusError
+}
+
+// githubWebhookAction stores a native GitHub webhook.
+// Deliveries the tracker does not keep are acknowledged
+// so that GitHub does not report them as failed
+func (t *Tracker) githubWebhookAction(w http.ResponseWriter, event string, body []byte) {
+	if event == githubPing {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	action, err := webhookAction(event, body)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"event": event,
+		}).Info("Error unmarshalling")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if action == nil {
+		logrus.WithFields(logrus.Fields{
+			"event": event,
+		}).Info("Ignored GitHub webhook")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := t.DB.Save(action); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":  err,
+			"action": action,
+		}).Info("Error saving")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
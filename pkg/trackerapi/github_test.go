@@ -0,0 +1,185 @@
+package trackerapi
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"ringier/pkg/statsdb"
+	"testing"
+)
+
+var workflowRunWebhook string = `{
+	"action": "completed",
+	"workflow_run": {
+		"id": 30433642,
+		"name": "Build",
+		"head_branch": "main",
+		"head_sha": "acb5820ced9479c074f688cc328bf03f341a511d",
+		"status": "completed",
+		"conclusion": "failure",
+		"html_url": "https://github.com/octo-org/octo-repo/actions/runs/30433642",
+		"created_at": "2020-01-22T19:33:08Z",
+		"pull_requests": [{"number": 412}],
+		"head_commit": {"author": {"name": "Octo Cat"}}
+	},
+	"repository": {
+		"name": "octo-repo",
+		"full_name": "octo-org/octo-repo"
+	}
+}`
+
+var checkSuiteWebhook string = `{
+	"action": "completed",
+	"check_suite": {
+		"id": 118578147,
+		"head_branch": "changes",
+		"head_sha": "ec26c3e57ca3a959ca5aad62de7213c562f8c821",
+		"status": "completed",
+		"conclusion": "success",
+		"url": "https://api.github.com/repos/Codertocat/Hello-World/check-suites/118578147",
+		"created_at": "2019-05-15T15:20:31Z",
+		"app": {"name": "GitHub Actions"}
+	},
+	"repository": {
+		"name": "Hello-World",
+		"full_name": "Codertocat/Hello-World"
+	}
+}`
+
+// TestTrackerApi_webhookAction checks the mapping of GitHub webhooks
+func TestTrackerApi_webhookAction(t *testing.T) {
+	testCases := []struct {
+		event  string
+		body   string
+		status string
+		pr     int
+		author string
+		want   *statsdb.WorkflowRun
+	}{
+		{event: githubWorkflowRun, body: workflowRunWebhook, status: statusFail, pr: 412, author: "Octo Cat", want: &statsdb.WorkflowRun{
+			RunID: 30433642, Repository: "octo-org/octo-repo", Branch: "main",
+			HeadSHA: "acb5820ced9479c074f688cc328bf03f341a511d", Workflow: "Build", Conclusion: "failure",
+			RunURL: "https://github.com/octo-org/octo-repo/actions/runs/30433642"}},
+		{event: githubCheckSuite, body: checkSuiteWebhook, status: statusPass, want: &statsdb.WorkflowRun{
+			RunID: 118578147, Repository: "Codertocat/Hello-World", Branch: "changes",
+			HeadSHA: "ec26c3e57ca3a959ca5aad62de7213c562f8c821", Workflow: "GitHub Actions", Conclusion: "success",
+			RunURL: "https://api.github.com/repos/Codertocat/Hello-World/check-suites/118578147"}},
+		{event: githubWorkflowRun, body: `{"action":"in_progress","workflow_run":{"id":1}}`},
+		{event: githubCheckSuite, body: workflowRunWebhook},
+		{event: "push", body: workflowRunWebhook},
+	}
+
+	for _, tc := range testCases {
+		action, err := webhookAction(tc.event, []byte(tc.body))
+		if err != nil {
+			t.Errorf("webhookAction(%q): want: %v, got: %v", tc.event, nil, err)
+			continue
+		}
+		if tc.want == nil {
+			if action != nil {
+				t.Errorf("webhookAction(%q): want: %v, got: %v", tc.event, nil, action)
+			}
+			continue
+		}
+		if action == nil || action.Workflow == nil {
+			t.Errorf("webhookAction(%q): want: %v, got: %v", tc.event, tc.want, action)
+			continue
+		}
+		if *action.Workflow != *tc.want || action.Payload.Status != tc.status || action.Event != tc.event {
+			t.Errorf("webhookAction(%q): want: %v %v, got: %v %v", tc.event, tc.want, tc.status, action.Workflow, action.Payload.Status)
+		}
+		if action.Repository != tc.want.Repository || action.Branch != tc.want.Branch || action.CommitSHA != tc.want.HeadSHA ||
+			action.PullRequest != tc.pr || action.Author != tc.author {
+			t.Errorf("webhookAction(%q): want: %v %v %v %v %v, got: %v %v %v %v %v", tc.event,
+				tc.want.Repository, tc.want.Branch, tc.want.HeadSHA, tc.pr, tc.author,
+				action.Repository, action.Branch, action.CommitSHA, action.PullRequest, action.Author)
+		}
+	}
+
+	if _, err := webhookAction(githubWorkflowRun, []byte(`{`)); err == nil {
+		t.Errorf("webhookAction(): want: an error for a broken body, got: %v", err)
+	}
+}
+
+// TestTrackerApi_githubWebhookAction checks if GitHub webhooks posted
+// to the action endpoint are stored with their workflow run
+func TestTrackerApi_githubWebhookAction(t *testing.T) {
+	tracker := &Tracker{Sources: []*Source{{Name: githubSourceName, Secrets: []SourceSecret{{Secret: "hook"}}}}}
+	tracker.DB = statsdb.NewMemStore()
+
+	testCases := []struct {
+		event string
+		body  string
+		want  int
+	}{
+		{event: githubPing, body: `{"zen":"Keep it logically awesome."}`, want: http.StatusOK},
+		{event: githubWorkflowRun, body: workflowRunWebhook, want: http.StatusOK},
+		{event: githubCheckSuite, body: `{"action":"requested","check_suite":{"id":1}}`, want: http.StatusNoContent},
+		{event: githubWorkflowRun, body: `[]`, want: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/action", bytes.NewReader([]byte(tc.body)))
+		r.Header.Set(githubEventHeader, tc.event)
+		r.Header.Set(signatureHeader, sign("hook", []byte(tc.body)))
+		tracker.Action(w, r)
+		if resp := w.Result(); resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.Action(%q): want: %v, got: %v", tc.event, tc.want, resp.StatusCode)
+		}
+	}
+
+	actions := tracker.DB.GetAllActions()
+	if len(actions) == 0 {
+		t.Errorf("StatsDB.GetAllActions(): want: the workflow run, got: none")
+		return
+	}
+	last := actions[len(actions)-1]
+	if last.Workflow == nil || last.Workflow.RunID != 30433642 || last.Payload.ServiceName != "octo-repo" {
+		t.Errorf("StatsDB.GetAllActions(): want: the workflow run, got: %v", last.Workflow)
+	}
+}
+
+// TestTrackerApi_webhookVerdict checks if a GitHub webhook received
+// between two coverage uploads does not hide a coverage drop
+func TestTrackerApi_webhookVerdict(t *testing.T) {
+	maxDrop := 2.0
+	tracker := &Tracker{Policies: map[string]Policy{"octo-repo": {MaxDrop: &maxDrop}}}
+	tracker.DB = statsdb.NewMemStore()
+
+	upload := func(report string) {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		form.WriteField("service", "octo-repo")
+		part, _ := form.CreateFormFile(reportField, "lcov.info")
+		part.Write([]byte(report))
+		form.Close()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/coverage", body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		tracker.CoverageUpload(w, r)
+		if resp := w.Result(); resp.StatusCode != http.StatusOK {
+			t.Errorf("trackerapi.CoverageUpload(): want: %v, got: %v", http.StatusOK, resp.StatusCode)
+		}
+	}
+
+	upload("SF:main.go\nDA:1,1\nDA:2,1\nend_of_record\n")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/action", bytes.NewReader([]byte(workflowRunWebhook)))
+	r.Header.Set(githubEventHeader, githubWorkflowRun)
+	tracker.Action(w, r)
+	if resp := w.Result(); resp.StatusCode != http.StatusOK {
+		t.Errorf("trackerapi.Action(%q): want: %v, got: %v", githubWorkflowRun, http.StatusOK, resp.StatusCode)
+	}
+	if last := tracker.DB.LastCoverage("octo-repo"); last == nil || last.Coverage != 100 {
+		t.Errorf("StatsDB.LastCoverage(): want: %v, got: %v", 100, last)
+	}
+	upload("SF:main.go\nDA:1,1\nDA:2,0\nend_of_record\n")
+
+	verdict := tracker.DB.GetVerdict("octo-repo")
+	if verdict == nil || verdict.Passed || len(verdict.Reasons) != 1 {
+		t.Errorf("StatsDB.GetVerdict(): want: a failing verdict, got: %v", verdict)
+	}
+}
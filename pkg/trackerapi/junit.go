@@ -0,0 +1,271 @@
+package trackerapi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"ringier/pkg/statsdb"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const junitEvent = "TestReportEvent"
+
+// junitProblem structure of the failure, error or skip of a JUnit test case
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitTestCase structure of a JUnit test case
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure"`
+	Error     *junitProblem `xml:"error"`
+	Skipped   *junitProblem `xml:"skipped"`
+}
+
+// junitTestSuite structure of a JUnit test suite,
+// suites can be nested
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	Timestamp string           `xml:"timestamp,attr"`
+	Cases     []junitTestCase  `xml:"testcase"`
+	Suites    []junitTestSuite `xml:"testsuite"`
+}
+
+// junitReport structure of a test report of a JUnit upload
+type junitReport struct {
+	ActionID int64               `json:"action_id"`
+	Created  bool                `json:"created"`
+	Suites   []statsdb.TestSuite `json:"suites"`
+}
+
+// parseJUnit reads the suites and the results of the test cases
+// of a JUnit XML report rooted at testsuites or testsuite
+func parseJUnit(r io.Reader) ([]statsdb.TestSuite, []statsdb.TestResult, error) {
+	decoder := xml.NewDecoder(r)
+	var root []junitTestSuite
+	for found := false; !found; {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad junit report: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		found = true
+		suite := junitTestSuite{}
+		switch start.Name.Local {
+		case "testsuites":
+			err = decoder.DecodeElement(&suite, &start)
+			root = suite.Suites
+		case "testsuite":
+			err = decoder.DecodeElement(&suite, &start)
+			root = []junitTestSuite{suite}
+		default:
+			return nil, nil, fmt.Errorf("bad junit report: unexpected element %q", start.Name.Local)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad junit report: %v", err)
+		}
+	}
+
+	suites := []statsdb.TestSuite{}
+	tests := []statsdb.TestResult{}
+	var walk func([]junitTestSuite)
+	walk = func(list []junitTestSuite) {
+		for _, s := range list {
+			if len(s.Cases) > 0 || len(s.Suites) == 0 {
+				suite, results := junitSuite(s)
+				suites = append(suites, suite)
+				tests = append(tests, results...)
+			}
+			walk(s.Suites)
+		}
+	}
+	walk(root)
+	return suites, tests, nil
+}
+
+// junitSuite converts a JUnit suite and its test cases.
+// The counts are taken from the test cases when there are some
+func junitSuite(s junitTestSuite) (statsdb.TestSuite, []statsdb.TestResult) {
+	suite := statsdb.TestSuite{
+		Name:      s.Name,
+		Tests:     s.Tests,
+		Failures:  s.Failures,
+		Errors:    s.Errors,
+		Skipped:   s.Skipped,
+		Time:      junitTime(s.Time),
+		Timestamp: s.Timestamp,
+	}
+	if len(s.Cases) == 0 {
+		return suite, nil
+	}
+
+	suite.Tests, suite.Failures, suite.Errors, suite.Skipped = len(s.Cases), 0, 0, 0
+	elapsed := 0.0
+	tests := []statsdb.TestResult{}
+	for _, c := range s.Cases {
+		test := statsdb.TestResult{
+			Package: c.Classname,
+			Name:    c.Name,
+			Status:  statusPass,
+			Elapsed: junitTime(c.Time),
+		}
+		if test.Package == "" {
+			test.Package = s.Name
+		}
+		switch {
+		case c.Failure != nil:
+			test.Status = statusFail
+			test.Output = c.Failure.output()
+			suite.Failures++
+		case c.Error != nil:
+			test.Status = statusError
+			test.Output = c.Error.output()
+			suite.Errors++
+		case c.Skipped != nil:
+			test.Status = statusSkip
+			test.Output = c.Skipped.output()
+			suite.Skipped++
+		}
+		elapsed += test.Elapsed
+		tests = append(tests, test)
+	}
+	if suite.Time == 0 {
+		suite.Time = elapsed
+	}
+	return suite, tests
+}
+
+// output formats the message and the details of a problem
+func (p *junitProblem) output() string {
+	output := strings.TrimSpace(strings.Join([]string{p.Message, strings.TrimSpace(p.Text)}, "\n"))
+	if len(output) > maxStderr {
+		output = output[:maxStderr]
+	}
+	return output
+}
+
+// junitTime parses a duration in seconds, some tools
+// write them with thousands separators
+func junitTime(s string) float64 {
+	t, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	if err != nil {
+		return 0
+	}
+	return t
+}
+
+// JUnitUpload endpoint to report the test results of a service
+// with JUnit XML reports.
+// POST /api/junit as multipart/form-data with the fields
+// service, repository, branch, commit, pull_request, author
+// and one or more report files.
+// The results are added to the last action of the service for the
+// commit or stored as a new action without coverage when there is none
+func (t *Tracker) JUnitUpload(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("tracker.JUnitUpload")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !t.parseUpload(w, r) {
+		return
+	}
+
+	service := r.FormValue("service")
+	if service == "" {
+		http.Error(w, "missing service", http.StatusBadRequest)
+		return
+	}
+	headers := r.MultipartForm.File[reportField]
+	if len(headers) == 0 {
+		http.Error(w, fmt.Sprintf("missing %s file", reportField), http.StatusBadRequest)
+		return
+	}
+	suites := []statsdb.TestSuite{}
+	tests := []statsdb.TestResult{}
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fileSuites, fileTests, err := parseJUnit(file)
+		file.Close()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"file":  header.Filename,
+			}).Info("Error reading the junit report")
+			http.Error(w, fmt.Sprintf("%s: %v", header.Filename, err), http.StatusBadRequest)
+			return
+		}
+		suites = append(suites, fileSuites...)
+		tests = append(tests, fileTests...)
+	}
+
+	report := &junitReport{Suites: suites}
+	if commit := r.FormValue("commit"); commit != "" {
+		report.ActionID = t.DB.CommitAction(service, commit)
+	}
+	if report.ActionID != 0 {
+		if err := t.DB.AddTestReport(report.ActionID, suites, tests); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, report)
+		return
+	}
+
+	action := &statsdb.GitHubAction{
+		Event:      junitEvent,
+		CreatedAt:  time.Now().UTC(),
+		ActionType: uploadActionType,
+		Version:    uploadFormVersion,
+		Payload: &statsdb.Payload{
+			ServiceName: service,
+			Status:      suitesStatus(suites),
+			NoCoverage:  true,
+			Tests:       tests,
+			Suites:      suites,
+		},
+	}
+	if err := uploadSource(r, action); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := t.saveAction(action); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	report.ActionID = action.ID
+	report.Created = true
+	writeJSON(w, report)
+}
+
+// suitesStatus returns the status of a test run made of suites
+func suitesStatus(suites []statsdb.TestSuite) string {
+	for _, suite := range suites {
+		if suite.Failures > 0 || suite.Errors > 0 {
+			return statusFail
+		}
+	}
+	return statusPass
+}
@@ -0,0 +1,162 @@
+package trackerapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"ringier/pkg/statsdb"
+	"strings"
+	"testing"
+)
+
+var junitXML string = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="jest tests" tests="4" failures="1" time="1,234.5">
+	<testsuite name="cart" tests="3" failures="1" skipped="1" time="0.6" timestamp="2021-03-02T08:30:00">
+		<testcase classname="cart.add" name="adds an item" time="0.1"/>
+		<testcase classname="cart.add" name="adds twice" time="0.5">
+			<failure message="expected 2, got 1" type="AssertionError">at cart.test.js:12</failure>
+		</testcase>
+		<testcase classname="cart.remove" name="removes an item" time="0">
+			<skipped/>
+		</testcase>
+	</testsuite>
+	<testsuite name="user">
+		<testsuite name="login" time="0.2">
+			<testcase name="logs in" time="0.2">
+				<error message="connection refused"/>
+			</testcase>
+		</testsuite>
+	</testsuite>
+</testsuites>
+`
+
+// TestTrackerApi_parseJUnit checks if the suites and the test cases
+// of JUnit reports are read
+func TestTrackerApi_parseJUnit(t *testing.T) {
+	suites, tests, err := parseJUnit(strings.NewReader(junitXML))
+	if err != nil {
+		t.Errorf("parseJUnit(): want: %v, got: %v", nil, err)
+		return
+	}
+	wantSuites := []statsdb.TestSuite{
+		{Name: "cart", Tests: 3, Failures: 1, Skipped: 1, Time: 0.6, Timestamp: "2021-03-02T08:30:00"},
+		{Name: "login", Tests: 1, Errors: 1, Time: 0.2},
+	}
+	if !reflect.DeepEqual(suites, wantSuites) {
+		t.Errorf("parseJUnit(): want: %v, got: %v", wantSuites, suites)
+	}
+	wantTests := []statsdb.TestResult{
+		{Package: "cart.add", Name: "adds an item", Status: statusPass, Elapsed: 0.1},
+		{Package: "cart.add", Name: "adds twice", Status: statusFail, Elapsed: 0.5, Output: "expected 2, got 1\nat cart.test.js:12"},
+		{Package: "cart.remove", Name: "removes an item", Status: statusSkip},
+		{Package: "login", Name: "logs in", Status: statusError, Elapsed: 0.2, Output: "connection refused"},
+	}
+	if !reflect.DeepEqual(tests, wantTests) {
+		t.Errorf("parseJUnit(): want: %v, got: %v", wantTests, tests)
+	}
+
+	testCases := []struct {
+		report string
+		suites int
+		err    bool
+	}{
+		{report: `<testsuite name="one" tests="2" failures="0" time="1.5"/>`, suites: 1},
+		{report: `<testsuites></testsuites>`, suites: 0},
+		{report: `<coverage/>`, err: true},
+		{report: `<testsuite name="one">`, err: true},
+		{report: ``, err: true},
+	}
+	for _, tc := range testCases {
+		suites, _, err := parseJUnit(strings.NewReader(tc.report))
+		if (err != nil) != tc.err || len(suites) != tc.suites {
+			t.Errorf("parseJUnit(%q): want: %v suites error %v, got: %v %v", tc.report, tc.suites, tc.err, suites, err)
+		}
+	}
+}
+
+// TestTrackerApi_JUnitUpload checks if the results of a JUnit report
+// are linked to the action of the same service and commit
+func TestTrackerApi_JUnitUpload(t *testing.T) {
+	tracker := &Tracker{}
+	tracker.DB = statsdb.NewMemStore()
+	coverage := &statsdb.GitHubAction{Event: uploadEvent, Payload: &statsdb.Payload{ServiceName: "shop", Coverage: 40},
+		CommitSHA: "4f2a9c1"}
+	if err := tracker.DB.Save(coverage); err != nil {
+		t.Errorf("Error saving action: %v", err)
+		return
+	}
+
+	testCases := []struct {
+		fields  map[string]string
+		reports []string
+		want    int
+		linked  bool
+	}{
+		{fields: map[string]string{"service": "shop", "commit": "4f2a9c1"}, reports: []string{junitXML}, want: http.StatusOK, linked: true},
+		{fields: map[string]string{"service": "search", "commit": "4f2a9c1"}, reports: []string{junitXML}, want: http.StatusOK},
+		{fields: map[string]string{"service": "shop"}, reports: []string{junitXML}, want: http.StatusOK},
+		{fields: map[string]string{"service": "shop"}, reports: []string{"<html/>"}, want: http.StatusBadRequest},
+		{fields: map[string]string{"service": "shop"}, want: http.StatusBadRequest},
+		{fields: map[string]string{}, reports: []string{junitXML}, want: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		for name, value := range tc.fields {
+			form.WriteField(name, value)
+		}
+		for _, report := range tc.reports {
+			part, _ := form.CreateFormFile(reportField, "junit.xml")
+			part.Write([]byte(report))
+		}
+		form.Close()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/junit", body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		tracker.JUnitUpload(w, r)
+		resp := w.Result()
+		if resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.JUnitUpload(%v): want: %v, got: %v", tc.fields, tc.want, resp.StatusCode)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		report := &junitReport{}
+		if err := json.NewDecoder(resp.Body).Decode(report); err != nil {
+			t.Errorf("trackerapi.JUnitUpload(): want: the report, got: %v", err)
+			continue
+		}
+		if linked := report.ActionID == coverage.ID; linked != tc.linked || report.Created == tc.linked {
+			t.Errorf("trackerapi.JUnitUpload(%v): want: linked %v, got: %v", tc.fields, tc.linked, report)
+		}
+		if suites := tracker.DB.GetTestSuites(report.ActionID); len(suites) != 2 {
+			t.Errorf("StatsDB.GetTestSuites(%d): want: %v suites, got: %v", report.ActionID, 2, suites)
+		}
+	}
+
+	if last := tracker.DB.LastCoverage("shop"); last == nil || last.Coverage != 40 {
+		t.Errorf("StatsDB.LastCoverage(): want: %v, got: %v", 40, last)
+	}
+	if last := tracker.DB.LastCoverage("search"); last != nil {
+		t.Errorf("StatsDB.LastCoverage(): want: %v, got: %v", nil, last)
+	}
+	for _, action := range tracker.DB.GetAllActions() {
+		if action.ID != coverage.ID {
+			if !action.Payload.NoCoverage {
+				t.Errorf("StatsDB.GetAllActions(): want: a report without coverage, got: %v", action.Payload)
+			}
+			continue
+		}
+		want := &statsdb.TestSummary{Tests: 4, Passed: 1, Failed: 2, Skipped: 1, Elapsed: 0.8}
+		if !reflect.DeepEqual(action.TestSummary, want) {
+			t.Errorf("StatsDB.GetAllActions(): want: %v, got: %v", want, action.TestSummary)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package trackerapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"ringier/pkg/statsdb"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queueSize          = 16
+	outboxBatch        = 64
+	defaultMaxAttempts = 8
+	retryInterval      = 5 * time.Second
+	retryBackoff       = 10 * time.Second
+	maxRetryBackoff    = time.Hour
+	maxResponseBody    = 4096
+	deliveryTimeout    = 30 * time.Second
+	adminTokenPrefix   = "Bearer "
+
+	// outboxLease how long a batch of events stays claimed by
+	// this tracker, long enough to time out on every event
+	outboxLease = outboxBatch * deliveryTimeout
+)
+
+var httpClient = &http.Client{Timeout: deliveryTimeout}
+
+// EventSink go-routine to emit test events
+// it start a thead for every sink and returns a channel
+// where it expects to find the outbox ids of new test events.
+// Events which failed to be delivered are retried from the outbox.
+// The channel is never closed, the sinks stop with the context
+// after a last round and leave the events stored later in the outbox
+func (t *Tracker) EventSink(ctx context.Context) chan<- int64 {
+	logrus.Info("tracker.EventSink")
+	c := make(chan int64, queueSize)
+	for _, sink := range t.Sinks {
+		sink.queue = make(chan struct{}, 1)
+		t.Wg.Add(1)
+		go t.sinkWorker(ctx, sink)
+	}
+	t.Wg.Add(1)
+	go func() {
+		defer t.Wg.Done()
+		for {
+			select {
+			case <-c:
+				t.wakeSinks()
+			case <-ctx.Done():
+				logrus.Info("EventSink done")
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// sinkWorker delivers the events of a sink when woken up
+// and retries the failed ones on a regular basis
+func (t *Tracker) sinkWorker(ctx context.Context, sink *Sink) {
+	defer t.Wg.Done()
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	t.deliverDue(sink)
+	for {
+		select {
+		case <-sink.queue:
+			t.deliverDue(sink)
+		case <-ticker.C:
+			t.deliverDue(sink)
+		case <-ctx.Done():
+			t.deliverDue(sink)
+			logrus.WithFields(logrus.Fields{
+				"sink": sink.Name,
+			}).Info("Sink done")
+			return
+		}
+	}
+}
+
+// wakeSinks wakes up the sinks which are not already busy,
+// a busy one picks its new events up on its next round
+func (t *Tracker) wakeSinks() {
+	for _, sink := range t.Sinks {
+		select {
+		case sink.queue <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// sendEvent formats a test action for every sink taking it
+// and stores it in the outbox before waking up the event sink
+func (t *Tracker) sendEvent(action *statsdb.GitHubAction) {
+	var id int64
+	for _, sink := range t.Sinks {
+		if !sink.Accepts(action) {
+			continue
+		}
+		buf, err := sink.Render(action)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sink":  sink.Name,
+			}).Info("Error formatting event")
+			continue
+		}
+		id, err = t.DB.Enqueue(sink.Name, string(buf))
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"sink":  sink.Name,
+			}).Info("Error storing event in the outbox")
+		}
+	}
+	if id == 0 {
+		return
+	}
+	select {
+	case t.Queue <- id:
+	default:
+		// the sinks are busy and pick the event up on their next round
+	}
+}
+
+// deliverDue claims the events of a sink which are due and
+// delivers them, the other trackers sharing the database skip them
+func (t *Tracker) deliverDue(sink *Sink) {
+	for {
+		now := time.Now()
+		events := t.DB.ClaimEvents(sink.Name, now, now.Add(outboxLease), outboxBatch)
+		for i := range events {
+			t.deliver(sink, &events[i])
+		}
+		if len(events) < outboxBatch {
+			return
+		}
+	}
+}
+
+// deliveryResult classification of a delivery attempt
+type deliveryResult int
+
+const (
+	deliverySuccess deliveryResult = iota
+	deliveryRetryable
+	deliveryPermanent
+)
+
+// deliver posts an event to its sink and stores the outcome,
+// scheduling a retry with an exponential backoff or giving up
+// on the event after too many attempts or when the sink refuses it
+func (t *Tracker) deliver(sink *Sink, event *statsdb.OutboxEvent) {
+	logrus.WithFields(logrus.Fields{
+		"event": event.Event,
+		"sink":  sink.Name,
+	}).Info("Sending test event")
+	event.Attempts++
+	event.LastError = ""
+	event.ResponseCode = 0
+	event.ResponseBody = ""
+
+	var resp *http.Response
+	req, err := sink.NewRequest(event.Event)
+	if err == nil {
+		resp, err = httpClient.Do(req)
+	}
+	if err != nil {
+		event.LastError = err.Error()
+	} else {
+		body, readErr := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		resp.Body.Close()
+		if readErr != nil {
+			event.LastError = readErr.Error()
+		}
+		event.ResponseCode = resp.StatusCode
+		event.ResponseBody = string(body)
+	}
+
+	switch classify(resp, err) {
+	case deliverySuccess:
+		logrus.WithFields(logrus.Fields{
+			"event":  event.Event,
+			"status": event.ResponseCode,
+		}).Info("Event Send")
+		event.Status = statsdb.OutboxSent
+	case deliveryPermanent:
+		logrus.WithFields(logrus.Fields{
+			"status": event.ResponseCode,
+			"body":   event.ResponseBody,
+		}).Info("Event refused")
+		event.Status = statsdb.OutboxFailed
+		if event.LastError == "" {
+			event.LastError = fmt.Sprintf("destination refused the event with status %d", event.ResponseCode)
+		}
+	default:
+		logrus.WithFields(logrus.Fields{
+			"Error":    event.LastError,
+			"status":   event.ResponseCode,
+			"attempts": event.Attempts,
+		}).Info("Error posting event")
+		if event.LastError == "" {
+			event.LastError = fmt.Sprintf("destination answered with status %d", event.ResponseCode)
+		}
+		event.Status = statsdb.OutboxPending
+		event.NextAttempt = time.Now().Add(backoff(event.Attempts))
+		if event.Attempts >= t.maxAttempts() {
+			event.Status = statsdb.OutboxDead
+		}
+	}
+	if err := t.DB.UpdateDelivery(event); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"id":    event.ID,
+		}).Info("Error updating outbox")
+	}
+}
+
+// classify classifies the outcome of a delivery attempt.
+// Transport errors, timeouts, throttling and server errors can be
+// retried while any other non 2xx status will fail again
+func classify(resp *http.Response, err error) deliveryResult {
+	if err != nil {
+		return deliveryRetryable
+	}
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return deliverySuccess
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return deliveryRetryable
+	default:
+		return deliveryPermanent
+	}
+}
+
+// maxAttempts returns the number of delivery attempts of an event
+func (t *Tracker) maxAttempts() int {
+	if t.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return t.MaxAttempts
+}
+
+// backoff returns the delay before the next delivery attempt
+// doubling it after every failed attempt
+func backoff(attempts int) time.Duration {
+	delay := retryBackoff
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return delay
+}
+
+// authorizeAdmin checks the bearer token of a request to an admin
+// endpoint against the admin token. Without an admin token every
+// request is refused. It answers a refused request with a 401
+// and returns false
+func (t *Tracker) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(header, adminTokenPrefix)
+	if t.AdminToken != "" && token != header &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(t.AdminToken)) == 1 {
+		return true
+	}
+	logrus.WithFields(logrus.Fields{
+		"remoteAddr": r.RemoteAddr,
+		"URL":        r.URL.Path,
+	}).Info("Rejected admin request")
+	w.Header().Set("WWW-Authenticate", `Bearer realm="tracker admin"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	return false
+}
+
+// OutboxAPI admin endpoint to the outbox listing its events
+// under /api/admin/outbox?status=dead and replaying a dead
+// or failed one under /api/admin/outbox/{id}/replay.
+// It takes the admin token as a bearer token
+func (t *Tracker) OutboxAPI(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("tracker.OutboxAPI")
+	if !t.authorizeAdmin(w, r) {
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/outbox"), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = statsdb.OutboxDead
+		}
+		writeJSON(w, t.DB.GetOutbox(status))
+		return
+	}
+
+	fields := strings.Split(path, "/")
+	if len(fields) != 2 || fields[1] != "replay" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"URL":   r.URL.Path,
+		}).Info("Error parsing event id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := t.DB.Replay(id); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"id":    id,
+		}).Info("Error replaying event")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, err)
+		return
+	}
+	select {
+	case t.Queue <- id:
+	default:
+	}
+	w.WriteHeader(http.StatusOK)
+}
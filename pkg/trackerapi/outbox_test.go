@@ -0,0 +1,230 @@
+package trackerapi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"ringier/pkg/statsdb"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTrackerApi_deliver checks if failed deliveries are retried
+// until the event is dead and that a dead event can be replayed
+func TestTrackerApi_deliver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Close()
+
+	tracker := &Tracker{MaxAttempts: 2, DestEndpoint: server.URL, AdminToken: "admin"}
+	tracker.DB = statsdb.NewMemStore()
+	if err := tracker.SetupSinks(); err != nil {
+		t.Errorf("Error setting up sinks: %v", err)
+		return
+	}
+	sink := tracker.Sinks[0]
+	queue := make(chan int64, queueSize)
+	tracker.Queue = queue
+	tracker.sendEvent(&statsdb.GitHubAction{Event: "deliver-test"})
+	id := <-queue
+
+	event := &statsdb.OutboxEvent{ID: id, Event: `{"event":"deliver-test"}`, Status: statsdb.OutboxPending}
+	tracker.deliver(sink, event)
+	if event.Status != statsdb.OutboxPending || event.Attempts != 1 || event.LastError == "" {
+		t.Errorf("Tracker.deliver(): want: a pending event after %v attempt, got: %v", 1, event)
+	}
+	if !event.NextAttempt.After(time.Now()) {
+		t.Errorf("Tracker.deliver(): want: a retry in the future, got: %v", event.NextAttempt)
+	}
+	tracker.deliver(sink, event)
+	if event.Status != statsdb.OutboxDead || event.Attempts != 2 {
+		t.Errorf("Tracker.deliver(): want: a dead event after %v attempts, got: %v", 2, event)
+	}
+
+	testCases := []struct {
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{method: http.MethodGet, path: "/api/admin/outbox?status=dead", want: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/api/admin/outbox?status=dead", token: "forged", want: http.StatusUnauthorized},
+		{method: http.MethodPost, path: fmt.Sprintf("/api/admin/outbox/%d/replay", id), want: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/api/admin/outbox?status=dead", token: "admin", want: http.StatusOK},
+		{method: http.MethodPost, path: fmt.Sprintf("/api/admin/outbox/%d/replay", id), token: "admin", want: http.StatusOK},
+		{method: http.MethodPost, path: fmt.Sprintf("/api/admin/outbox/%d/replay", id), token: "admin", want: http.StatusNotFound},
+		{method: http.MethodGet, path: fmt.Sprintf("/api/admin/outbox/%d/replay", id), token: "admin", want: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/api/admin/outbox/abc/replay", token: "admin", want: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		tracker.OutboxAPI(w, r)
+		if resp := w.Result(); resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.OutboxAPI(%s %q): want: %v, got: %v", tc.method, tc.path, tc.want, resp.StatusCode)
+		}
+	}
+
+	// without an admin token the admin endpoints are closed
+	tracker.AdminToken = ""
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/outbox", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	tracker.OutboxAPI(w, r)
+	if resp := w.Result(); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("trackerapi.OutboxAPI() without admin token: want: %v, got: %v", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+// TestTrackerApi_backoff checks if the retry delay doubles
+// up to its maximum
+func TestTrackerApi_backoff(t *testing.T) {
+	testCases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 10 * time.Second},
+		{attempts: 2, want: 20 * time.Second},
+		{attempts: 4, want: 80 * time.Second},
+		{attempts: 20, want: time.Hour},
+	}
+
+	for _, tc := range testCases {
+		if got := backoff(tc.attempts); got != tc.want {
+			t.Errorf("backoff(%d): want: %v, got: %v", tc.attempts, tc.want, got)
+		}
+	}
+}
+
+// TestTrackerApi_deliverResponses checks if the response of the
+// destination decides the delivery status of an event
+func TestTrackerApi_deliverResponses(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "maintenance")
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "no such endpoint")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tracker := &Tracker{}
+	tracker.DB = statsdb.NewMemStore()
+
+	testCases := []struct {
+		path   string
+		status string
+		code   int
+		body   string
+	}{
+		{path: "/ok", status: statsdb.OutboxSent, code: http.StatusAccepted},
+		{path: "/down", status: statsdb.OutboxPending, code: http.StatusServiceUnavailable, body: "maintenance"},
+		{path: "/missing", status: statsdb.OutboxFailed, code: http.StatusNotFound, body: "no such endpoint"},
+	}
+
+	for _, tc := range testCases {
+		sink := &Sink{Name: "test", URL: server.URL + tc.path}
+		id, err := tracker.DB.Enqueue(sink.Name, `{"event":"test"}`)
+		if err != nil {
+			t.Errorf("Error storing event: %v", err)
+			return
+		}
+		event := &statsdb.OutboxEvent{ID: id, Event: `{"event":"test"}`, Status: statsdb.OutboxPending}
+		tracker.deliver(sink, event)
+		if event.Status != tc.status || event.ResponseCode != tc.code || event.ResponseBody != tc.body {
+			t.Errorf("Tracker.deliver(%q): want: %v %v %q, got: %v %v %q", tc.path,
+				tc.status, tc.code, tc.body, event.Status, event.ResponseCode, event.ResponseBody)
+		}
+	}
+
+	failed := tracker.DB.GetOutbox(statsdb.OutboxFailed)
+	if len(failed) == 0 || failed[len(failed)-1].ResponseBody != "no such endpoint" {
+		t.Errorf("StatsDB.GetOutbox(%q): want: the refused event, got: %v", statsdb.OutboxFailed, failed)
+	}
+}
+
+// TestTrackerApi_classify checks the classification of delivery attempts
+func TestTrackerApi_classify(t *testing.T) {
+	testCases := []struct {
+		code int
+		err  error
+		want deliveryResult
+	}{
+		{code: http.StatusOK, want: deliverySuccess},
+		{code: http.StatusNoContent, want: deliverySuccess},
+		{code: http.StatusRequestTimeout, want: deliveryRetryable},
+		{code: http.StatusTooManyRequests, want: deliveryRetryable},
+		{code: http.StatusBadGateway, want: deliveryRetryable},
+		{err: fmt.Errorf("connection refused"), want: deliveryRetryable},
+		{code: http.StatusBadRequest, want: deliveryPermanent},
+		{code: http.StatusUnauthorized, want: deliveryPermanent},
+		{code: http.StatusMovedPermanently, want: deliveryPermanent},
+	}
+
+	for _, tc := range testCases {
+		var resp *http.Response
+		if tc.err == nil {
+			resp = &http.Response{StatusCode: tc.code}
+		}
+		if got := classify(resp, tc.err); got != tc.want {
+			t.Errorf("classify(%v, %v): want: %v, got: %v", tc.code, tc.err, tc.want, got)
+		}
+	}
+}
+
+// TestTrackerApi_EventSinkStop checks if a local test run ending
+// after the sinks stopped is waited for and leaves its events
+// in the outbox instead of sending them on a closed channel
+func TestTrackerApi_EventSinkStop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	script := filepath.Join(t.TempDir(), "slow-test")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\nsleep 1\n"), 0755); err != nil {
+		t.Errorf("Error writing the test command: %v", err)
+		return
+	}
+	tracker := &Tracker{DestEndpoint: server.URL, Services: map[string]TestConfig{"test": {Command: script}}}
+	tracker.DB = statsdb.NewMemStore()
+	if err := tracker.SetupSinks(); err != nil {
+		t.Errorf("Error setting up sinks: %v", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker.Queue = tracker.EventSink(ctx)
+
+	w := httptest.NewRecorder()
+	tracker.Action(w, httptest.NewRequest(http.MethodPost, "/action", strings.NewReader(githubAction)))
+	if resp := w.Result(); resp.StatusCode != http.StatusOK {
+		t.Errorf("trackerapi.Action(): want: %v, got: %v", http.StatusOK, resp.StatusCode)
+	}
+	cancel()
+	tracker.Wg.Wait()
+
+	local := 0
+	for _, action := range tracker.DB.GetAllActions() {
+		if action.TriggerID != 0 {
+			local++
+		}
+	}
+	if pending := tracker.DB.GetOutbox(statsdb.OutboxPending); local == 0 || len(pending) != local {
+		t.Errorf("Tracker.EventSink(): want: the events of %v local actions pending, got: %v", local, len(pending))
+	}
+}
@@ -0,0 +1,111 @@
+package trackerapi
+
+import (
+	"fmt"
+	"net/http"
+	"ringier/pkg/statsdb"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Policy structure of the coverage rules of a service
+type Policy struct {
+	MinCoverage float64         `mapstructure:"minCoverage"`
+	MaxDrop     *float64        `mapstructure:"maxDrop"`
+	Packages    []PackagePolicy `mapstructure:"packages"`
+}
+
+// PackagePolicy structure of the coverage rules of a package,
+// its maximum drop defaults to the one of the service
+type PackagePolicy struct {
+	Package     string   `mapstructure:"package"`
+	MinCoverage float64  `mapstructure:"minCoverage"`
+	MaxDrop     *float64 `mapstructure:"maxDrop"`
+}
+
+// policy returns the coverage rules of a service
+func (t *Tracker) policy(service string) Policy {
+	return t.Policies[strings.ToLower(service)]
+}
+
+// Evaluate checks the coverage of an action against the rules
+// comparing it with the last coverage stored for the service
+func (p Policy) Evaluate(payload *statsdb.Payload, last *statsdb.Payload) *statsdb.Verdict {
+	verdict := &statsdb.Verdict{ServiceName: payload.ServiceName, Reasons: []string{}}
+	lastCoverage := 0.0
+	if last != nil {
+		lastCoverage = last.Coverage
+	}
+	verdict.Reasons = append(verdict.Reasons,
+		checkCoverage("coverage", payload.Coverage, p.MinCoverage, lastCoverage, last != nil, p.MaxDrop)...)
+
+	overrides := map[string]PackagePolicy{}
+	for _, pkg := range p.Packages {
+		overrides[pkg.Package] = pkg
+	}
+	lastPackages := map[string]float64{}
+	if last != nil {
+		for _, pkg := range last.Packages {
+			lastPackages[pkg.Package] = pkg.Coverage
+		}
+	}
+	for _, pkg := range payload.Packages {
+		rule, ok := overrides[pkg.Package]
+		if !ok {
+			continue
+		}
+		if rule.MaxDrop == nil {
+			rule.MaxDrop = p.MaxDrop
+		}
+		lastCoverage, ok := lastPackages[pkg.Package]
+		verdict.Reasons = append(verdict.Reasons,
+			checkCoverage("package "+pkg.Package+" coverage", pkg.Coverage, rule.MinCoverage, lastCoverage, ok, rule.MaxDrop)...)
+	}
+
+	verdict.Passed = len(verdict.Reasons) == 0
+	return verdict
+}
+
+// checkCoverage checks a coverage against a minimum and
+// the maximum drop from its last value
+func checkCoverage(name string, coverage, minCoverage, last float64, hasLast bool, maxDrop *float64) []string {
+	reasons := []string{}
+	if coverage < minCoverage {
+		reasons = append(reasons, fmt.Sprintf("%s %.1f is below the minimum of %.1f", name, coverage, minCoverage))
+	}
+	if maxDrop != nil && hasLast && last-coverage > *maxDrop {
+		reasons = append(reasons, fmt.Sprintf("%s dropped by %.1f from %.1f, more than the allowed %.1f",
+			name, round(last-coverage), last, *maxDrop))
+	}
+	return reasons
+}
+
+// evaluatePolicy evaluates the coverage rules of the service of an action
+// before it gets saved
+func (t *Tracker) evaluatePolicy(action *statsdb.GitHubAction) *statsdb.Verdict {
+	service := action.Payload.ServiceName
+	return t.policy(service).Evaluate(action.Payload, t.DB.LastCoverage(service))
+}
+
+// VerdictAPI endpoint to the last verdict of a service
+// served under /api/verdict/{service}
+func (t *Tracker) VerdictAPI(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("tracker.VerdictAPI")
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	service := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/verdict/"), "/")
+	if service == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	verdict := t.DB.GetVerdict(service)
+	if verdict == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, verdict)
+}
@@ -0,0 +1,106 @@
+package trackerapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"ringier/pkg/statsdb"
+	"testing"
+)
+
+// TestTrackerApi_PolicyEvaluate checks if the coverage rules
+// of a service produce the expected verdict
+func TestTrackerApi_PolicyEvaluate(t *testing.T) {
+	maxDrop := 2.5
+	policy := Policy{
+		MinCoverage: 20,
+		MaxDrop:     &maxDrop,
+		Packages: []PackagePolicy{
+			{Package: "ringier/pkg/statsdb", MinCoverage: 50},
+		},
+	}
+	last := &statsdb.Payload{
+		Coverage: 30,
+		Packages: []statsdb.PackageCoverage{{Package: "ringier/pkg/statsdb", Coverage: 60}},
+	}
+
+	testCases := []struct {
+		payload *statsdb.Payload
+		last    *statsdb.Payload
+		want    []string
+	}{
+		{
+			payload: &statsdb.Payload{Coverage: 29},
+			last:    last,
+			want:    []string{},
+		},
+		{
+			payload: &statsdb.Payload{Coverage: 15},
+			want:    []string{"coverage 15.0 is below the minimum of 20.0"},
+		},
+		{
+			payload: &statsdb.Payload{Coverage: 25},
+			last:    last,
+			want:    []string{"coverage dropped by 5.0 from 30.0, more than the allowed 2.5"},
+		},
+		{
+			payload: &statsdb.Payload{
+				Coverage: 30,
+				Packages: []statsdb.PackageCoverage{
+					{Package: "ringier/pkg/statsdb", Coverage: 45},
+					{Package: "ringier/pkg/trackerapi", Coverage: 10},
+				},
+			},
+			last: last,
+			want: []string{
+				"package ringier/pkg/statsdb coverage 45.0 is below the minimum of 50.0",
+				"package ringier/pkg/statsdb coverage dropped by 15.0 from 60.0, more than the allowed 2.5",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		got := policy.Evaluate(tc.payload, tc.last)
+		if !reflect.DeepEqual(got.Reasons, tc.want) || got.Passed != (len(tc.want) == 0) {
+			t.Errorf("Policy.Evaluate(%v): want: %v, got: %v %v", tc.payload, tc.want, got.Passed, got.Reasons)
+		}
+	}
+}
+
+// TestTrackerApi_VerdictAPI checks if the last verdict
+// of a service is served
+func TestTrackerApi_VerdictAPI(t *testing.T) {
+	tracker := &Tracker{}
+	tracker.DB = statsdb.NewMemStore()
+	verdict := &statsdb.Verdict{ActionID: 1, ServiceName: "verdict-test", Passed: false,
+		Reasons: []string{"coverage 15.0 is below the minimum of 20.0"}}
+	if err := tracker.DB.SaveVerdict(verdict); err != nil {
+		t.Errorf("Error saving verdict: %v", err)
+		return
+	}
+
+	testCases := []struct {
+		path string
+		want int
+	}{
+		{path: "/api/verdict/verdict-test", want: http.StatusOK},
+		{path: "/api/verdict/unknown", want: http.StatusNotFound},
+		{path: "/api/verdict/", want: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		tracker.VerdictAPI(w, r)
+		if resp := w.Result(); resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.VerdictAPI(%q): want: %v, got: %v", tc.path, tc.want, resp.StatusCode)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	tracker.VerdictAPI(w, httptest.NewRequest(http.MethodGet, "/api/verdict/verdict-test", nil))
+	want := `{"action_id":1,"service_name":"verdict-test","passed":false,"reasons":["coverage 15.0 is below the minimum of 20.0"]}`
+	if got := w.Body.String(); got != want {
+		t.Errorf("trackerapi.VerdictAPI(): want: %v, got: %v", want, got)
+	}
+}
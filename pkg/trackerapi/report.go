@@ -0,0 +1,309 @@
+package trackerapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"ringier/pkg/statsdb"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	formatGo        = "go"
+	formatCobertura = "cobertura"
+	formatLCOV      = "lcov"
+
+	maxUpload         = 32 << 20
+	reportField       = "report"
+	uploadEvent       = "CoverageReportEvent"
+	uploadActionType  = "upload"
+	uploadFormVersion = "1.0.0"
+)
+
+// CoverageUpload endpoint to report the coverage of a service
+// with coverage report files instead of a computed number.
+// POST /api/coverage as multipart/form-data with the fields
+// service, format (go, cobertura or lcov, guessed when missing),
+// repository, branch, commit, pull_request, author and one or more report files
+func (t *Tracker) CoverageUpload(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("tracker.CoverageUpload")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !t.parseUpload(w, r) {
+		return
+	}
+
+	action, err := uploadAction(r)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error reading the coverage reports")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := t.saveAction(action); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, action)
+}
+
+// parseUpload verifies the signature of an upload and parses
+// its multipart form. It answers the request and returns false
+// when the upload cannot be read
+func (t *Tracker) parseUpload(w http.ResponseWriter, r *http.Request) bool {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxUpload))
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error reading response")
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+	if reason := t.verifySignature(r, body); reason != "" {
+		t.rejectAction(w, r, reason)
+		return false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := r.ParseMultipartForm(maxUpload); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error parsing the upload")
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// uploadSource sets the repository, branch, commit, pull_request
+// and author fields of an upload on its action
+func uploadSource(r *http.Request, action *statsdb.GitHubAction) error {
+	if value := r.FormValue("pull_request"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return fmt.Errorf("bad pull_request %q", value)
+		}
+		action.PullRequest = number
+	}
+	action.Repository = r.FormValue("repository")
+	action.Branch = r.FormValue("branch")
+	action.CommitSHA = r.FormValue("commit")
+	action.Author = r.FormValue("author")
+	return nil
+}
+
+// uploadAction builds the action of an uploaded set of coverage
+// reports with the coverage of all of their files
+func uploadAction(r *http.Request) (*statsdb.GitHubAction, error) {
+	service := r.FormValue("service")
+	if service == "" {
+		return nil, fmt.Errorf("missing service")
+	}
+	headers := r.MultipartForm.File[reportField]
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("missing %s file", reportField)
+	}
+
+	format := strings.ToLower(r.FormValue("format"))
+	reports := [][]statsdb.FileCoverage{}
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		files, err := readReport(format, file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", header.Filename, err)
+		}
+		reports = append(reports, files)
+	}
+	files := mergeFiles(reports...)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file found in the %s files", reportField)
+	}
+
+	action := &statsdb.GitHubAction{
+		Event:      uploadEvent,
+		CreatedAt:  time.Now().UTC(),
+		ActionType: uploadActionType,
+		Version:    uploadFormVersion,
+		Payload: &statsdb.Payload{
+			ServiceName: service,
+			Coverage:    totalCoverage(files),
+			Files:       files,
+		},
+	}
+	if err := uploadSource(r, action); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// detectFormat guesses the format of a coverage report
+// from the start of its content
+func detectFormat(head []byte) string {
+	text := strings.TrimSpace(string(head))
+	switch {
+	case strings.HasPrefix(text, "mode:"):
+		return formatGo
+	case strings.HasPrefix(text, "<"):
+		return formatCobertura
+	case strings.HasPrefix(text, "TN:"), strings.HasPrefix(text, "SF:"):
+		return formatLCOV
+	}
+	return ""
+}
+
+// parseReport computes the coverage of every file found
+// in a coverage report of a format
+func parseReport(format string, r io.Reader) ([]statsdb.FileCoverage, error) {
+	switch format {
+	case formatGo:
+		return parseCoverProfile(r)
+	case formatCobertura:
+		return parseCobertura(r)
+	case formatLCOV:
+		return parseLCOV(r)
+	}
+	return nil, fmt.Errorf("unknown coverage report format %q", format)
+}
+
+// coberturaReport structure of the parts of a Cobertura XML
+// report the tracker reads
+type coberturaReport struct {
+	XMLName  xml.Name `xml:"coverage"`
+	Packages []struct {
+		Classes []struct {
+			Filename string `xml:"filename,attr"`
+			Lines    []struct {
+				Number int `xml:"number,attr"`
+				Hits   int `xml:"hits,attr"`
+			} `xml:"lines>line"`
+		} `xml:"classes>class"`
+	} `xml:"packages>package"`
+}
+
+// parseCobertura computes the line coverage of every file
+// found in a Cobertura XML report
+func parseCobertura(r io.Reader) ([]statsdb.FileCoverage, error) {
+	report := &coberturaReport{}
+	if err := xml.NewDecoder(r).Decode(report); err != nil {
+		return nil, fmt.Errorf("bad cobertura report: %v", err)
+	}
+	lines := lineHits{}
+	for _, pkg := range report.Packages {
+		for _, class := range pkg.Classes {
+			for _, line := range class.Lines {
+				lines.add(class.Filename, line.Number, line.Hits)
+			}
+		}
+	}
+	return lines.files(), nil
+}
+
+// parseLCOV computes the line coverage of every file
+// found in an LCOV tracefile
+func parseLCOV(r io.Reader) ([]statsdb.FileCoverage, error) {
+	lines := lineHits{}
+	file := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			file = strings.TrimPrefix(line, "SF:")
+		case strings.HasPrefix(line, "DA:"):
+			fields := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if len(fields) < 2 || file == "" {
+				return nil, fmt.Errorf("bad lcov line: %q", line)
+			}
+			number, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("bad line number in lcov line: %q", line)
+			}
+			hits, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("bad hit count in lcov line: %q", line)
+			}
+			lines.add(file, number, hits)
+		case line == "end_of_record":
+			file = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines.files(), nil
+}
+
+// lineHits hit counts of the lines of every file of a report.
+// Reports listing a line several times add up its hits
+type lineHits map[string]map[int]int
+
+// add counts the hits of a line of a file
+func (l lineHits) add(file string, line, hits int) {
+	if l[file] == nil {
+		l[file] = map[int]int{}
+	}
+	l[file][line] += hits
+}
+
+// files computes the line coverage of every file
+func (l lineHits) files() []statsdb.FileCoverage {
+	files := []statsdb.FileCoverage{}
+	for name, lines := range l {
+		file := statsdb.FileCoverage{File: name, Statements: len(lines)}
+		for _, hits := range lines {
+			if hits > 0 {
+				file.Covered++
+			}
+		}
+		file.Coverage = percent(file.Covered, file.Statements)
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].File < files[j].File })
+	return files
+}
+
+// mergeFiles merges the coverage of files found in several reports,
+// a file reported twice keeps its last coverage
+func mergeFiles(reports ...[]statsdb.FileCoverage) []statsdb.FileCoverage {
+	byFile := map[string]statsdb.FileCoverage{}
+	for _, files := range reports {
+		for _, file := range files {
+			byFile[file.File] = file
+		}
+	}
+	files := []statsdb.FileCoverage{}
+	for _, file := range byFile {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].File < files[j].File })
+	return files
+}
+
+// readReport reads a coverage report detecting its format
+// when none is given
+func readReport(format string, r io.Reader) ([]statsdb.FileCoverage, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = detectFormat(content)
+	}
+	return parseReport(format, bytes.NewReader(content))
+}
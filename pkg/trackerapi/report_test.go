@@ -0,0 +1,174 @@
+package trackerapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"ringier/pkg/statsdb"
+	"strings"
+	"testing"
+)
+
+var coberturaXML string = `<?xml version="1.0" ?>
+<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">
+<coverage line-rate="0.6" branch-rate="0" version="1.9" timestamp="1600000000">
+	<packages>
+		<package name="app" line-rate="0.6">
+			<classes>
+				<class name="Cart" filename="app/cart.py" line-rate="0.5">
+					<lines>
+						<line number="1" hits="1"/>
+						<line number="2" hits="0"/>
+					</lines>
+				</class>
+				<class name="Order" filename="app/cart.py" line-rate="1">
+					<lines>
+						<line number="2" hits="3"/>
+						<line number="4" hits="0"/>
+					</lines>
+				</class>
+				<class name="User" filename="app/user.py" line-rate="0.5">
+					<lines>
+						<line number="1" hits="2"/>
+						<line number="5" hits="0"/>
+					</lines>
+				</class>
+			</classes>
+		</package>
+	</packages>
+</coverage>
+`
+
+var lcovTrace string = `TN:
+SF:src/cart.js
+FN:1,add
+FNDA:2,add
+DA:1,2
+DA:2,0
+DA:3,1,d41d8cd98f00b204e9800998ecf8427e
+LF:3
+LH:2
+end_of_record
+SF:src/user.js
+DA:1,0
+end_of_record
+`
+
+// TestTrackerApi_parseReport checks if the line coverage of every
+// file is computed from the supported report formats
+func TestTrackerApi_parseReport(t *testing.T) {
+	testCases := []struct {
+		report string
+		format string
+		want   []statsdb.FileCoverage
+	}{
+		{report: coberturaXML, format: formatCobertura, want: []statsdb.FileCoverage{
+			{File: "app/cart.py", Statements: 3, Covered: 2, Coverage: 66.7},
+			{File: "app/user.py", Statements: 2, Covered: 1, Coverage: 50.0},
+		}},
+		{report: lcovTrace, format: formatLCOV, want: []statsdb.FileCoverage{
+			{File: "src/cart.js", Statements: 3, Covered: 2, Coverage: 66.7},
+			{File: "src/user.js", Statements: 1, Covered: 0, Coverage: 0},
+		}},
+		{report: coverProfile, format: formatGo, want: []statsdb.FileCoverage{
+			{File: "ringier/pkg/statsdb/sqllite.go", Statements: 4, Covered: 3, Coverage: 75.0},
+			{File: "ringier/pkg/trackerapi/tracker_api.go", Statements: 4, Covered: 3, Coverage: 75.0},
+		}},
+	}
+
+	for _, tc := range testCases {
+		if got := detectFormat([]byte(tc.report)); got != tc.format {
+			t.Errorf("detectFormat(): want: %v, got: %v", tc.format, got)
+		}
+		got, err := readReport("", strings.NewReader(tc.report))
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("readReport(%s): want: %v, got: %v %v", tc.format, tc.want, got, err)
+		}
+	}
+
+	errorCases := []struct {
+		format string
+		report string
+	}{
+		{format: formatCobertura, report: "<coverage><packages>"},
+		{format: formatLCOV, report: "SF:a.js\nDA:x,1\n"},
+		{format: formatLCOV, report: "DA:1,1\n"},
+		{format: "", report: "plain text"},
+	}
+	for _, tc := range errorCases {
+		if _, err := readReport(tc.format, strings.NewReader(tc.report)); err == nil {
+			t.Errorf("readReport(%q, %q): want: an error, got: %v", tc.format, tc.report, err)
+		}
+	}
+}
+
+// TestTrackerApi_CoverageUpload checks if uploaded reports are stored
+// as one action with the coverage of all of their files
+func TestTrackerApi_CoverageUpload(t *testing.T) {
+	tracker := &Tracker{}
+	tracker.DB = statsdb.NewMemStore()
+
+	testCases := []struct {
+		fields  map[string]string
+		reports []string
+		want    int
+	}{
+		{fields: map[string]string{"service": "shop", "commit": "ec26c3e", "branch": "feature", "pull_request": "412", "author": "Octo Cat"},
+			reports: []string{coberturaXML, lcovTrace}, want: http.StatusOK},
+		{fields: map[string]string{"service": "shop", "pull_request": "pr"}, reports: []string{lcovTrace}, want: http.StatusBadRequest},
+		{fields: map[string]string{"service": "shop", "format": formatLCOV}, reports: []string{coberturaXML}, want: http.StatusBadRequest},
+		{fields: map[string]string{"service": "shop"}, want: http.StatusBadRequest},
+		{fields: map[string]string{}, reports: []string{lcovTrace}, want: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		for name, value := range tc.fields {
+			form.WriteField(name, value)
+		}
+		for _, report := range tc.reports {
+			part, _ := form.CreateFormFile(reportField, "report")
+			part.Write([]byte(report))
+		}
+		form.Close()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/coverage", body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		tracker.CoverageUpload(w, r)
+		resp := w.Result()
+		if resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.CoverageUpload(%v): want: %v, got: %v", tc.fields, tc.want, resp.StatusCode)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		action := &statsdb.GitHubAction{}
+		if err := json.NewDecoder(resp.Body).Decode(action); err != nil {
+			t.Errorf("trackerapi.CoverageUpload(): want: the stored action, got: %v", err)
+			continue
+		}
+		if action.Payload.Coverage != 55.6 || action.Workflow != nil {
+			t.Errorf("trackerapi.CoverageUpload(): want: coverage %v without workflow run, got: %v %v", 55.6, action.Payload.Coverage, action.Workflow)
+		}
+		if action.CommitSHA != "ec26c3e" || action.Branch != "feature" || action.PullRequest != 412 || action.Author != "Octo Cat" {
+			t.Errorf("trackerapi.CoverageUpload(): want: the source of the upload, got: %v %v %v %v",
+				action.CommitSHA, action.Branch, action.PullRequest, action.Author)
+		}
+		if files := tracker.DB.GetCoverage(action.ID).Files; len(files) != 4 {
+			t.Errorf("StatsDB.GetCoverage(%d): want: %v files, got: %v", action.ID, 4, files)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	tracker.CoverageUpload(w, httptest.NewRequest(http.MethodGet, "/api/coverage", nil))
+	if resp := w.Result(); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("trackerapi.CoverageUpload(GET): want: %v, got: %v", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
@@ -0,0 +1,158 @@
+package trackerapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"ringier/pkg/signature"
+	"ringier/pkg/statsdb"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultSinkName    = "default"
+	defaultContentType = "application/json"
+)
+
+// SinkAuth structure of the authentication of a sink
+type SinkAuth struct {
+	Type     string `mapstructure:"type"`
+	Token    string `mapstructure:"token"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// Sink structure of a destination of the test events
+type Sink struct {
+	Name        string            `mapstructure:"name"`
+	URL         string            `mapstructure:"url"`
+	Headers     map[string]string `mapstructure:"headers"`
+	Auth        SinkAuth          `mapstructure:"auth"`
+	Events      []string          `mapstructure:"events"`
+	Services    []string          `mapstructure:"services"`
+	ContentType string            `mapstructure:"contentType"`
+	Template    string            `mapstructure:"template"`
+	Signing     signature.Key     `mapstructure:"signing"`
+
+	tmpl  *template.Template
+	queue chan struct{}
+}
+
+// SetupSinks checks the configured sinks and parses their payload
+// templates. Without any sink the events go to the destination endpoint.
+// A sink without its own signing key signs with the key of the tracker.
+// A signing key needs a secret, without any key the events are not signed
+func (t *Tracker) SetupSinks() error {
+	if t.Signing.ID != "" && t.Signing.Secret == "" {
+		return fmt.Errorf("signing key %q has no secret", t.Signing.ID)
+	}
+	if len(t.Sinks) == 0 {
+		t.Sinks = []*Sink{{Name: defaultSinkName, URL: t.DestEndpoint}}
+	}
+	names := map[string]bool{}
+	for i, sink := range t.Sinks {
+		if sink.Name == "" {
+			sink.Name = fmt.Sprintf("sink%d", i)
+		}
+		if names[sink.Name] {
+			return fmt.Errorf("sink %q is configured twice", sink.Name)
+		}
+		names[sink.Name] = true
+		if sink.ContentType == "" {
+			sink.ContentType = defaultContentType
+		}
+		if sink.Signing.ID != "" && sink.Signing.Secret == "" {
+			return fmt.Errorf("sink %q signing key %q has no secret", sink.Name, sink.Signing.ID)
+		}
+		if sink.Signing.Secret == "" {
+			sink.Signing = t.Signing
+		}
+		switch strings.ToLower(sink.Auth.Type) {
+		case "", "bearer", "basic":
+		default:
+			return fmt.Errorf("sink %q has an unknown auth type %q", sink.Name, sink.Auth.Type)
+		}
+		if sink.Template != "" {
+			tmpl, err := template.New(sink.Name).Parse(sink.Template)
+			if err != nil {
+				return fmt.Errorf("sink %q template: %v", sink.Name, err)
+			}
+			sink.tmpl = tmpl
+		}
+	}
+	return nil
+}
+
+// Accepts returns true if the sink takes the events of an action
+func (s *Sink) Accepts(action *statsdb.GitHubAction) bool {
+	if len(s.Events) > 0 && !contains(s.Events, action.Event) {
+		return false
+	}
+	if len(s.Services) > 0 && (action.Payload == nil || !contains(s.Services, action.Payload.ServiceName)) {
+		return false
+	}
+	return true
+}
+
+// Render formats an action with the payload template of the sink
+// or as json when the sink has none
+func (s *Sink) Render(action *statsdb.GitHubAction) ([]byte, error) {
+	if s.tmpl == nil {
+		return json.Marshal(action)
+	}
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, action); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewRequest builds the request posting an event to the sink,
+// signed at the time of the attempt when the sink has a key
+func (s *Sink) NewRequest(event string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(event))
+	if err != nil {
+		return nil, err
+	}
+	contentType := s.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+	switch strings.ToLower(s.Auth.Type) {
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+s.Auth.Token)
+	case "basic":
+		req.SetBasicAuth(s.Auth.Username, s.Auth.Password)
+	}
+	if s.Signing.Secret != "" {
+		s.Signing.SignRequest(req, []byte(event), time.Now())
+	}
+	return req, nil
+}
+
+// sink returns the sink with a name
+func (t *Tracker) sink(name string) *Sink {
+	for _, sink := range t.Sinks {
+		if sink.Name == name {
+			return sink
+		}
+	}
+	return nil
+}
+
+// contains returns true if a value is in a list ignoring the case
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
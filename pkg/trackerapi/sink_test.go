@@ -0,0 +1,194 @@
+package trackerapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"ringier/pkg/signature"
+	"ringier/pkg/statsdb"
+	"sync"
+	"testing"
+)
+
+// TestTrackerApi_SetupSinks checks the defaults and the validation
+// of the configured sinks
+func TestTrackerApi_SetupSinks(t *testing.T) {
+	testCases := []struct {
+		sinks   []*Sink
+		signing signature.Key
+		want    []string
+		err     bool
+	}{
+		{want: []string{"default"}},
+		{sinks: []*Sink{{Name: "slack"}, {}}, want: []string{"slack", "sink1"}},
+		{sinks: []*Sink{{Name: "a"}, {Name: "a"}}, err: true},
+		{sinks: []*Sink{{Name: "a", Auth: SinkAuth{Type: "digest"}}}, err: true},
+		{sinks: []*Sink{{Name: "a", Template: "{{.Event"}}, err: true},
+		{signing: signature.Key{ID: "2026-10", Secret: "s"}, want: []string{"default"}},
+		{signing: signature.Key{ID: "2026-10"}, err: true},
+		{sinks: []*Sink{{Name: "a", Signing: signature.Key{ID: "a"}}}, err: true},
+	}
+
+	for _, tc := range testCases {
+		tracker := &Tracker{DestEndpoint: "http://localhost/events", Sinks: tc.sinks, Signing: tc.signing}
+		err := tracker.SetupSinks()
+		if (err != nil) != tc.err {
+			t.Errorf("Tracker.SetupSinks(%v): want: error %v, got: %v", tc.sinks, tc.err, err)
+			continue
+		}
+		if tc.err {
+			continue
+		}
+		if len(tracker.Sinks) != len(tc.want) {
+			t.Errorf("Tracker.SetupSinks(): want: %v, got: %v", tc.want, tracker.Sinks)
+			continue
+		}
+		for i, sink := range tracker.Sinks {
+			if sink.Name != tc.want[i] || sink.ContentType != defaultContentType {
+				t.Errorf("Tracker.SetupSinks(): want: %v, got: %v %v", tc.want[i], sink.Name, sink.ContentType)
+			}
+		}
+	}
+}
+
+// TestTrackerApi_SinkAccepts checks the event and service filters of a sink
+func TestTrackerApi_SinkAccepts(t *testing.T) {
+	action := &statsdb.GitHubAction{Event: "push", Payload: &statsdb.Payload{ServiceName: "Billing"}}
+	testCases := []struct {
+		sink *Sink
+		want bool
+	}{
+		{sink: &Sink{}, want: true},
+		{sink: &Sink{Events: []string{"push", "release"}}, want: true},
+		{sink: &Sink{Events: []string{"release"}}, want: false},
+		{sink: &Sink{Services: []string{"billing"}}, want: true},
+		{sink: &Sink{Services: []string{"search"}}, want: false},
+		{sink: &Sink{Events: []string{"push"}, Services: []string{"search"}}, want: false},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.sink.Accepts(action); got != tc.want {
+			t.Errorf("Sink.Accepts(%v, %v): want: %v, got: %v", tc.sink.Events, tc.sink.Services, tc.want, got)
+		}
+	}
+}
+
+// TestTrackerApi_SinkRender checks the payload template of a sink
+func TestTrackerApi_SinkRender(t *testing.T) {
+	action := &statsdb.GitHubAction{Event: "push", Payload: &statsdb.Payload{ServiceName: "billing", Coverage: 42.5}}
+	testCases := []struct {
+		template string
+		want     string
+	}{
+		{template: `{"text":"{{.Payload.ServiceName}} {{.Event}}: {{.Payload.Coverage}}%"}`, want: `{"text":"billing push: 42.5%"}`},
+		{template: `{{.Payload.ServiceName}}`, want: `billing`},
+	}
+
+	for _, tc := range testCases {
+		tracker := &Tracker{Sinks: []*Sink{{Name: "test", Template: tc.template}}}
+		if err := tracker.SetupSinks(); err != nil {
+			t.Errorf("Tracker.SetupSinks(): want: %v, got: %v", nil, err)
+			continue
+		}
+		got, err := tracker.Sinks[0].Render(action)
+		if err != nil || string(got) != tc.want {
+			t.Errorf("Sink.Render(%q): want: %v, got: %v %v", tc.template, tc.want, string(got), err)
+		}
+	}
+}
+
+// TestTrackerApi_fanOut checks if an event goes to every sink
+// accepting it with the headers and the authentication of the sink
+func TestTrackerApi_fanOut(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.URL.Path] = r.Header
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tracker := &Tracker{Wg: sync.WaitGroup{}}
+	tracker.DB = statsdb.NewMemStore()
+	tracker.Sinks = []*Sink{
+		{Name: "bearer", URL: server.URL + "/bearer", Auth: SinkAuth{Type: "bearer", Token: "secret"}},
+		{Name: "basic", URL: server.URL + "/basic", Auth: SinkAuth{Type: "basic", Username: "user", Password: "pass"},
+			Headers: map[string]string{"X-Team": "qa"}},
+		{Name: "text", URL: server.URL + "/text", ContentType: "text/plain", Template: "{{.Event}}"},
+		{Name: "release", URL: server.URL + "/release", Events: []string{"release"}},
+	}
+	if err := tracker.SetupSinks(); err != nil {
+		t.Errorf("Error setting up sinks: %v", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker.Queue = tracker.EventSink(ctx)
+	tracker.sendEvent(&statsdb.GitHubAction{Event: "push"})
+	cancel()
+	tracker.Wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	testCases := []struct {
+		path   string
+		header string
+		want   string
+	}{
+		{path: "/bearer", header: "Authorization", want: "Bearer secret"},
+		{path: "/basic", header: "Authorization", want: "Basic dXNlcjpwYXNz"},
+		{path: "/basic", header: "X-Team", want: "qa"},
+		{path: "/text", header: "Content-Type", want: "text/plain"},
+	}
+	for _, tc := range testCases {
+		header, ok := received[tc.path]
+		if !ok {
+			t.Errorf("Tracker.sendEvent(): want: a delivery to %v, got: none", tc.path)
+			continue
+		}
+		if got := header.Get(tc.header); got != tc.want {
+			t.Errorf("Tracker.sendEvent(%v): want: %v %q, got: %q", tc.path, tc.header, tc.want, got)
+		}
+	}
+	if _, ok := received["/release"]; ok {
+		t.Errorf("Tracker.sendEvent(): want: no delivery to %v, got: one", "/release")
+	}
+}
+
+// TestTrackerApi_signedDelivery checks if the events of a sink are
+// signed so that a receiver using the signature package accepts them
+func TestTrackerApi_signedDelivery(t *testing.T) {
+	verifier := signature.NewVerifier(map[string]string{"tracker": "secret"}, 0)
+	var got error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = verifier.Verify(r.Header, body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tracker := &Tracker{
+		Signing: signature.Key{ID: "tracker", Secret: "secret"},
+		Sinks:   []*Sink{{Name: "signed", URL: server.URL}},
+	}
+	if err := tracker.SetupSinks(); err != nil {
+		t.Errorf("Error setting up sinks: %v", err)
+		return
+	}
+	req, err := tracker.Sinks[0].NewRequest(`{"event":"push"}`)
+	if err != nil {
+		t.Errorf("Sink.NewRequest(): want: %v, got: %v", nil, err)
+		return
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Errorf("Error posting the event: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if got != nil {
+		t.Errorf("Verifier.Verify(): want: %v, got: %v", nil, got)
+	}
+}
@@ -0,0 +1,177 @@
+package trackerapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"ringier/pkg/statsdb"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	signatureHeader   = "X-Hub-Signature-256"
+	signaturePrefix   = "sha256="
+	sourceHeader      = "X-Tracker-Source"
+	defaultSourceName = "default"
+	auditLimit        = 100
+)
+
+// SourceSecret structure of a shared secret of a source.
+// A secret without expiry is valid until it is removed
+type SourceSecret struct {
+	Secret  string `mapstructure:"secret"`
+	Expires string `mapstructure:"expires"`
+
+	expires time.Time
+}
+
+// Source structure of a sender of webhooks and its shared secrets.
+// Several secrets are valid at the same time while one is rotated
+type Source struct {
+	Name    string         `mapstructure:"name"`
+	Secrets []SourceSecret `mapstructure:"secrets"`
+}
+
+// SetupSources checks the configured sources and parses the expiry
+// of their secrets. Without any source the webhooks are not verified
+func (t *Tracker) SetupSources() error {
+	names := map[string]bool{}
+	for _, source := range t.Sources {
+		if source.Name == "" {
+			source.Name = defaultSourceName
+		}
+		if names[source.Name] {
+			return fmt.Errorf("source %q is configured twice", source.Name)
+		}
+		names[source.Name] = true
+		if len(source.Secrets) == 0 {
+			return fmt.Errorf("source %q has no secret", source.Name)
+		}
+		for i := range source.Secrets {
+			secret := &source.Secrets[i]
+			if secret.Secret == "" {
+				return fmt.Errorf("source %q has an empty secret", source.Name)
+			}
+			if secret.Expires == "" {
+				continue
+			}
+			expires, err := time.Parse(time.RFC3339, secret.Expires)
+			if err != nil {
+				return fmt.Errorf("source %q secret expiry: %v", source.Name, err)
+			}
+			secret.expires = expires
+		}
+	}
+	return nil
+}
+
+// valid returns true if the secret has not expired yet
+func (s *SourceSecret) valid(now time.Time) bool {
+	return s.expires.IsZero() || now.Before(s.expires)
+}
+
+// source returns the source with a name
+func (t *Tracker) source(name string) *Source {
+	for _, source := range t.Sources {
+		if source.Name == name {
+			return source
+		}
+	}
+	return nil
+}
+
+// verifySignature checks the signature of a webhook against
+// the valid secrets of its source. It returns the reason
+// of the rejection or an empty string if the webhook is genuine
+func (t *Tracker) verifySignature(r *http.Request, body []byte) string {
+	if len(t.Sources) == 0 {
+		return ""
+	}
+	name := sourceName(r)
+	source := t.source(name)
+	if source == nil {
+		return fmt.Sprintf("unknown source %q", name)
+	}
+	signature := r.Header.Get(signatureHeader)
+	if signature == "" {
+		return "missing signature"
+	}
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return "malformed signature"
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil {
+		return "malformed signature"
+	}
+	now := time.Now()
+	for _, secret := range source.Secrets {
+		if !secret.valid(now) {
+			continue
+		}
+		mac := hmac.New(sha256.New, []byte(secret.Secret))
+		mac.Write(body)
+		if hmac.Equal(got, mac.Sum(nil)) {
+			return ""
+		}
+	}
+	return "signature mismatch"
+}
+
+// sourceName returns the source a webhook claims to come from.
+// GitHub cannot send custom headers so its webhooks come from
+// the github source
+func sourceName(r *http.Request) string {
+	if name := r.Header.Get(sourceHeader); name != "" {
+		return name
+	}
+	if r.Header.Get(githubEventHeader) != "" {
+		return githubSourceName
+	}
+	return defaultSourceName
+}
+
+// rejectAction answers an unauthenticated webhook and keeps
+// a record of it in the audit table
+func (t *Tracker) rejectAction(w http.ResponseWriter, r *http.Request, reason string) {
+	failure := &statsdb.AuthFailure{
+		Source:     sourceName(r),
+		RemoteAddr: r.RemoteAddr,
+		Signature:  r.Header.Get(signatureHeader),
+		Reason:     reason,
+	}
+	logrus.WithFields(logrus.Fields{
+		"source":     failure.Source,
+		"remoteAddr": failure.RemoteAddr,
+		"reason":     reason,
+	}).Info("Rejected action")
+	if err := t.DB.SaveAuthFailure(failure); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error saving the rejected action")
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// AuditAPI admin endpoint to list the last rejected webhooks
+// GET /api/admin/audit. It takes the admin token as a bearer token
+func (t *Tracker) AuditAPI(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("tracker.AuditAPI")
+	if !t.authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	failures := t.DB.GetAuthFailures(auditLimit)
+	if failures == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, failures)
+}
@@ -0,0 +1,139 @@
+package trackerapi
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"ringier/pkg/statsdb"
+	"testing"
+	"time"
+)
+
+// sign returns the signature header value of a body
+// computed with a secret
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// TestTrackerApi_SetupSources checks the validation of the sources
+func TestTrackerApi_SetupSources(t *testing.T) {
+	testCases := []struct {
+		sources []*Source
+		err     bool
+	}{
+		{},
+		{sources: []*Source{{Secrets: []SourceSecret{{Secret: "s"}}}}},
+		{sources: []*Source{{Name: "ci", Secrets: []SourceSecret{{Secret: "old", Expires: "2030-01-02T15:04:05Z"}, {Secret: "new"}}}}},
+		{sources: []*Source{{Name: "ci"}}, err: true},
+		{sources: []*Source{{Name: "ci", Secrets: []SourceSecret{{}}}}, err: true},
+		{sources: []*Source{{Name: "ci", Secrets: []SourceSecret{{Secret: "s", Expires: "tomorrow"}}}}, err: true},
+		{sources: []*Source{{Secrets: []SourceSecret{{Secret: "s"}}}, {Name: "default", Secrets: []SourceSecret{{Secret: "s"}}}}, err: true},
+	}
+
+	for i, tc := range testCases {
+		tracker := &Tracker{Sources: tc.sources}
+		if err := tracker.SetupSources(); (err != nil) != tc.err {
+			t.Errorf("Tracker.SetupSources(case %d): want: error %v, got: %v", i, tc.err, err)
+		}
+	}
+}
+
+// TestTrackerApi_verifySignature checks the signature of webhooks
+// during the rotation of a secret
+func TestTrackerApi_verifySignature(t *testing.T) {
+	expired := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	tracker := &Tracker{Sources: []*Source{
+		{Name: "default", Secrets: []SourceSecret{{Secret: "old"}, {Secret: "new"}}},
+		{Name: "ci", Secrets: []SourceSecret{{Secret: "retired", Expires: expired}, {Secret: "current"}}},
+	}}
+	if err := tracker.SetupSources(); err != nil {
+		t.Errorf("Tracker.SetupSources(): want: %v, got: %v", nil, err)
+		return
+	}
+	body := []byte(`{"event":"push"}`)
+
+	testCases := []struct {
+		source    string
+		signature string
+		want      string
+	}{
+		{signature: sign("old", body), want: ""},
+		{signature: sign("new", body), want: ""},
+		{source: "ci", signature: sign("current", body), want: ""},
+		{source: "ci", signature: sign("retired", body), want: "signature mismatch"},
+		{source: "ci", signature: sign("old", body), want: "signature mismatch"},
+		{source: "other", signature: sign("old", body), want: `unknown source "other"`},
+		{want: "missing signature"},
+		{signature: "sha1=abc", want: "malformed signature"},
+		{signature: "sha256=xyz", want: "malformed signature"},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodPost, "/action", bytes.NewReader(body))
+		if tc.source != "" {
+			r.Header.Set(sourceHeader, tc.source)
+		}
+		if tc.signature != "" {
+			r.Header.Set(signatureHeader, tc.signature)
+		}
+		if got := tracker.verifySignature(r, body); got != tc.want {
+			t.Errorf("Tracker.verifySignature(%q, %q): want: %q, got: %q", tc.source, tc.signature, tc.want, got)
+		}
+	}
+
+	if got := (&Tracker{}).verifySignature(httptest.NewRequest(http.MethodPost, "/action", nil), body); got != "" {
+		t.Errorf("Tracker.verifySignature(): want: no check without sources, got: %q", got)
+	}
+}
+
+// TestTrackerApi_rejectAction checks if a forged webhook is refused
+// and shows up in the audit endpoint
+func TestTrackerApi_rejectAction(t *testing.T) {
+	tracker := &Tracker{
+		Sources:    []*Source{{Name: "default", Secrets: []SourceSecret{{Secret: "secret"}}}},
+		AdminToken: "admin",
+	}
+	tracker.DB = statsdb.NewMemStore()
+	if err := tracker.SetupSources(); err != nil {
+		t.Errorf("Error setting up sources: %v", err)
+		return
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/action", bytes.NewReader([]byte(githubAction)))
+	r.Header.Set(signatureHeader, sign("forged", []byte(githubAction)))
+	tracker.Action(w, r)
+	if resp := w.Result(); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("trackerapi.Action(): want: %v, got: %v", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	failures := tracker.DB.GetAuthFailures(1)
+	if len(failures) != 1 || failures[0].Reason != "signature mismatch" || failures[0].Source != defaultSourceName {
+		t.Errorf("StatsDB.GetAuthFailures(): want: the forged webhook, got: %v", failures)
+	}
+
+	testCases := []struct {
+		token string
+		want  int
+	}{
+		{want: http.StatusUnauthorized},
+		{token: "secret", want: http.StatusUnauthorized},
+		{token: "admin", want: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/api/admin/audit", nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		tracker.AuditAPI(w, r)
+		if resp := w.Result(); resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.AuditAPI(%q): want: %v, got: %v", tc.token, tc.want, resp.StatusCode)
+		}
+	}
+}
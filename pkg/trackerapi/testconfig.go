@@ -0,0 +1,66 @@
+package trackerapi
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTestCommand = "go"
+	defaultTestDir     = "."
+	defaultTestTimeout = 10 * time.Minute
+)
+
+// TestConfig structure of the local test run configuration of a service
+type TestConfig struct {
+	Command  string        `mapstructure:"command"`
+	Dir      string        `mapstructure:"dir"`
+	Packages []string      `mapstructure:"packages"`
+	Tags     []string      `mapstructure:"tags"`
+	Race     bool          `mapstructure:"race"`
+	Count    int           `mapstructure:"count"`
+	Env      []string      `mapstructure:"env"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// testConfig returns the test run configuration of a service
+// falling back to testing the working directory
+func (t *Tracker) testConfig(service string) TestConfig {
+	cfg, ok := t.Services[strings.ToLower(service)]
+	if !ok {
+		cfg = TestConfig{}
+	}
+	if cfg.Command == "" {
+		cfg.Command = defaultTestCommand
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = defaultTestDir
+	}
+	if len(cfg.Packages) == 0 {
+		cfg.Packages = []string{defaultModule}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTestTimeout
+	}
+	return cfg
+}
+
+// Args builds the arguments of the test command
+// writing the coverage to a coverprofile when given
+func (c TestConfig) Args(coverprofile string) []string {
+	args := []string{"test", "-json", "-cover"}
+	if coverprofile != "" {
+		args = append(args, "-coverprofile", coverprofile)
+	}
+	if len(c.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(c.Tags, ","))
+	}
+	if c.Race {
+		args = append(args, "-race")
+	}
+	if c.Count > 0 {
+		args = append(args, "-count", strconv.Itoa(c.Count))
+	}
+	return append(args, c.Packages...)
+}
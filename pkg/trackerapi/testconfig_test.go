@@ -0,0 +1,83 @@
+package trackerapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestTrackerApi_testConfig checks if a service gets its configured
+// test run or the default one
+func TestTrackerApi_testConfig(t *testing.T) {
+	tracker := &Tracker{Services: map[string]TestConfig{
+		"billing": {Dir: "/src/billing", Packages: []string{"./pkg/..."}, Timeout: time.Minute},
+	}}
+
+	testCases := []struct {
+		service string
+		want    TestConfig
+	}{
+		{
+			service: "Billing",
+			want: TestConfig{
+				Command:  "go",
+				Dir:      "/src/billing",
+				Packages: []string{"./pkg/..."},
+				Timeout:  time.Minute,
+			},
+		},
+		{
+			service: "unknown",
+			want: TestConfig{
+				Command:  "go",
+				Dir:      ".",
+				Packages: []string{"./..."},
+				Timeout:  10 * time.Minute,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		got := tracker.testConfig(tc.service)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Tracker.testConfig(%q): want: %v, got: %v", tc.service, tc.want, got)
+		}
+	}
+}
+
+// TestTrackerApi_TestConfigArgs checks if the test command
+// line is built from the configuration
+func TestTrackerApi_TestConfigArgs(t *testing.T) {
+	testCases := []struct {
+		cfg          TestConfig
+		coverprofile string
+		want         []string
+	}{
+		{
+			cfg:  TestConfig{Packages: []string{"./..."}},
+			want: []string{"test", "-json", "-cover", "./..."},
+		},
+		{
+			cfg:          TestConfig{Packages: []string{"./..."}},
+			coverprofile: "/tmp/cover.out",
+			want:         []string{"test", "-json", "-cover", "-coverprofile", "/tmp/cover.out", "./..."},
+		},
+		{
+			cfg: TestConfig{
+				Packages: []string{"./pkg/...", "./cmd/..."},
+				Tags:     []string{"integration", "sqlite"},
+				Race:     true,
+				Count:    1,
+			},
+			want: []string{"test", "-json", "-cover", "-tags", "integration,sqlite",
+				"-race", "-count", "1", "./pkg/...", "./cmd/..."},
+		},
+	}
+
+	for _, tc := range testCases {
+		got := tc.cfg.Args(tc.coverprofile)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("TestConfig.Args(): want: %v, got: %v", tc.want, got)
+		}
+	}
+}
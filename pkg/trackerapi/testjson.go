@@ -0,0 +1,186 @@
+package trackerapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"ringier/pkg/statsdb"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testEvent structure of an event emitted by go test -json
+type testEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// packageResult structure of the outcome of a tested package
+type packageResult struct {
+	Package     string
+	Status      string
+	Elapsed     float64
+	Coverage    float64
+	HasCoverage bool
+	Tests       []*statsdb.TestResult
+	tests       map[string]*statsdb.TestResult
+}
+
+// testRun structure of the outcome of a go test -json run
+type testRun struct {
+	Packages []*packageResult
+	packages map[string]*packageResult
+}
+
+// parseTestEvents builds the outcome of a test run
+// from the test2json event stream
+func parseTestEvents(out []byte) *testRun {
+	run := &testRun{packages: map[string]*packageResult{}}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		event := testEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"line":  scanner.Text(),
+			}).Debug("Skipping non json test output")
+			continue
+		}
+		if event.Package == "" {
+			continue
+		}
+		run.add(&event)
+	}
+	if err := scanner.Err(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error reading test events")
+	}
+	return run
+}
+
+// add applies a test event to the package it belongs to
+func (run *testRun) add(event *testEvent) {
+	pkg, ok := run.packages[event.Package]
+	if !ok {
+		pkg = &packageResult{
+			Package: event.Package,
+			tests:   map[string]*statsdb.TestResult{},
+		}
+		run.packages[event.Package] = pkg
+		run.Packages = append(run.Packages, pkg)
+	}
+
+	if event.Test == "" {
+		switch event.Action {
+		case "output":
+			if coverage, ok := parseCoverage(event.Output); ok {
+				pkg.Coverage = coverage
+				pkg.HasCoverage = true
+			}
+		case statusPass, statusFail, statusSkip:
+			pkg.Status = event.Action
+			pkg.Elapsed = event.Elapsed
+		}
+		return
+	}
+
+	test, ok := pkg.tests[event.Test]
+	if !ok {
+		test = &statsdb.TestResult{Package: event.Package, Name: event.Test}
+		pkg.tests[event.Test] = test
+		pkg.Tests = append(pkg.Tests, test)
+	}
+	switch event.Action {
+	case "output":
+		test.Output += event.Output
+	case statusPass, statusFail, statusSkip:
+		test.Status = event.Action
+		test.Elapsed = event.Elapsed
+		if event.Action != statusFail {
+			test.Output = ""
+		}
+	}
+}
+
+// Failed returns true if any tested package failed
+func (run *testRun) Failed() bool {
+	for _, pkg := range run.Packages {
+		if pkg.Status == statusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Actions generates a test action for every package of the run
+// and a last one with the coverage rolled up for the module
+func (run *testRun) Actions(service, module string) []*statsdb.GitHubAction {
+	if len(run.Packages) == 0 {
+		return nil
+	}
+	actions := []*statsdb.GitHubAction{}
+	total, covered := 0.0, 0
+	for _, pkg := range run.Packages {
+		action := newTestAction(service, pkg.Package, pkg.Coverage)
+		action.Payload.Status = pkg.Status
+		for _, test := range pkg.Tests {
+			action.Payload.Tests = append(action.Payload.Tests, *test)
+		}
+		actions = append(actions, action)
+		if pkg.HasCoverage {
+			total += pkg.Coverage
+			covered++
+		}
+	}
+	if covered > 0 {
+		total /= float64(covered)
+	}
+
+	action := newTestAction(service, module, total)
+	for _, pkg := range run.Packages {
+		if pkg.HasCoverage {
+			action.Payload.Packages = append(action.Payload.Packages, statsdb.PackageCoverage{
+				Package:  pkg.Package,
+				Coverage: pkg.Coverage,
+			})
+		}
+	}
+	action.Payload.Status = statusPass
+	if run.Failed() {
+		action.Payload.Status = statusFail
+	}
+	return append(actions, action)
+}
+
+// parseCoverage extracts the coverage weight from
+// a line of go test output
+func parseCoverage(line string) (float64, bool) {
+	beg := strings.Index(line, "coverage:")
+	if beg == -1 {
+		return 0, false
+	}
+	beg += len("coverage:")
+	end := strings.Index(line[beg:], "%")
+	if end == -1 {
+		return 0, false
+	}
+	coverage := strings.TrimSpace(line[beg : beg+end])
+	coverageVal, err := strconv.ParseFloat(coverage, 64)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"value": coverage,
+		}).Info("Could not convert coverage")
+		return 0, false
+	}
+	return coverageVal, true
+}
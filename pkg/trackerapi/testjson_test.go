@@ -0,0 +1,88 @@
+package trackerapi
+
+import (
+	"testing"
+)
+
+// TestTrackerApi_parseCoverage checks if the coverage weight
+// can be extracted from a line of test output
+func TestTrackerApi_parseCoverage(t *testing.T) {
+	testCases := []struct {
+		line string
+		want float64
+		ok   bool
+	}{
+		{line: "coverage: 63.3% of statements\n", want: 63.3, ok: true},
+		{line: "ok  \tringier/pkg/statsdb\t(cached)\tcoverage: 63.3% of statements\n", want: 63.3, ok: true},
+		{line: "?   \tringier/cmd/tracker\t[no test files]\n", ok: false},
+		{line: "coverage: [no statements]\n", ok: false},
+	}
+
+	for _, tc := range testCases {
+		got, ok := parseCoverage(tc.line)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseCoverage(%q): want: %v %v, got: %v %v", tc.line, tc.want, tc.ok, got, ok)
+		}
+	}
+}
+
+var testEvents string = `{"Action":"run","Package":"ringier/pkg/statsdb","Test":"TestA"}
+{"Action":"output","Package":"ringier/pkg/statsdb","Test":"TestA","Output":"=== RUN   TestA\n"}
+{"Action":"pass","Package":"ringier/pkg/statsdb","Test":"TestA","Elapsed":0.01}
+{"Action":"run","Package":"ringier/pkg/statsdb","Test":"TestB"}
+{"Action":"output","Package":"ringier/pkg/statsdb","Test":"TestB","Output":"    sqllite_test.go:10: boom\n"}
+{"Action":"fail","Package":"ringier/pkg/statsdb","Test":"TestB","Elapsed":0.02}
+{"Action":"output","Package":"ringier/pkg/statsdb","Output":"coverage: 60.0% of statements\n"}
+{"Action":"fail","Package":"ringier/pkg/statsdb","Elapsed":0.05}
+{"Action":"output","Package":"ringier/pkg/trackerapi","Output":"ok  \tringier/pkg/trackerapi\t(cached)\tcoverage: 40.0% of statements\n"}
+{"Action":"pass","Package":"ringier/pkg/trackerapi","Elapsed":0}
+{"Action":"output","Package":"ringier/cmd/tracker","Output":"?   \tringier/cmd/tracker\t[no test files]\n"}
+{"Action":"skip","Package":"ringier/cmd/tracker","Elapsed":0}
+not a json line
+`
+
+// TestTrackerApi_parseTestEvents checks if the outcome of every package
+// and test is built from the test2json event stream
+func TestTrackerApi_parseTestEvents(t *testing.T) {
+	run := parseTestEvents([]byte(testEvents))
+	if !run.Failed() {
+		t.Errorf("testRun.Failed(): want: %v, got: %v", true, false)
+	}
+
+	actions := run.Actions("test", "ringier")
+	testCases := []struct {
+		event    string
+		status   string
+		coverage float64
+		tests    int
+	}{
+		{event: "ringier/pkg/statsdb", status: "fail", coverage: 60.0, tests: 2},
+		{event: "ringier/pkg/trackerapi", status: "pass", coverage: 40.0},
+		{event: "ringier/cmd/tracker", status: "skip"},
+		{event: "ringier", status: "fail", coverage: 50.0},
+	}
+	if len(actions) != len(testCases) {
+		t.Errorf("testRun.Actions(): want: %v actions, got: %v", len(testCases), len(actions))
+		return
+	}
+
+	for i, tc := range testCases {
+		got := actions[i]
+		if got.Event != tc.event || got.Payload.Status != tc.status ||
+			got.Payload.Coverage != tc.coverage || len(got.Payload.Tests) != tc.tests {
+			t.Errorf("testRun.Actions()[%d]: want: %v, got: %v %v", i, tc, got.Event, got.Payload)
+		}
+	}
+
+	tests := actions[0].Payload.Tests
+	if tests[0].Status != "pass" || tests[0].Output != "" {
+		t.Errorf("passing test: want: no output, got: %q", tests[0].Output)
+	}
+	if tests[1].Status != "fail" || tests[1].Output != "    sqllite_test.go:10: boom\n" {
+		t.Errorf("failing test: want: its output, got: %q", tests[1].Output)
+	}
+
+	if got := parseTestEvents([]byte("")).Actions("test", "ringier"); got != nil {
+		t.Errorf("testRun.Actions(): want: %v, got: %v", nil, got)
+	}
+}
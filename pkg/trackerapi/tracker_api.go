@@ -1,37 +1,68 @@
 package trackerapi
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
+	"ringier/pkg/signature"
 	"ringier/pkg/statsdb"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	guuid "github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	queueSize = 16
+	defaultModule = "./..."
+	maxStderr     = 64 * 1024
+
+	nextCursorHeader = "X-Next-Cursor"
+	dateLayout       = "2006-01-02"
+	defaultLimit     = 100
+	maxLimit         = 1000
+	payloadPrefix    = "payload."
+
+	statusPass  = "pass"
+	statusFail  = "fail"
+	statusSkip  = "skip"
+	statusError = "error"
 )
 
 var TemplateFuncs = template.FuncMap{"rangeStruct": rangeStructer}
 
+// StatsPage structure of the data of the stats web page
+type StatsPage struct {
+	Actions []statsdb.GitHubAction
+	Flaky   []FlakyTest
+}
+
 // Tracker structure of a Tracker object
 type Tracker struct {
-	DB               *statsdb.StatsDB
+	DB               statsdb.Store
 	HTMLTemplate     *template.Template
 	HTMLTemplateName string
 	DestEndpoint     string
-	Queue            chan<- string
+	Services         map[string]TestConfig
+	Policies         map[string]Policy
+	Queue            chan<- int64
+	MaxAttempts      int
+	Sinks            []*Sink
+	Sources          []*Source
+	Signing          signature.Key
+	FlakyWindow      int
+	AdminToken       string
 	Wg               sync.WaitGroup
 }
 
@@ -59,6 +90,7 @@ func (t *Tracker) DefaultPath(w http.ResponseWriter, r *http.Request) {
 }
 
 // StatsAPI endpoint to StatsAPI
+// it writes the actions as a JSON array, as NDJSON or as CSV
 func (t *Tracker) StatsAPI(w http.ResponseWriter, r *http.Request) {
 	logrus.Info("tracker.StatsAPI")
 	if r.Method != http.MethodGet {
@@ -66,25 +98,187 @@ func (t *Tracker) StatsAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	actions := t.DB.GetAllActions()
-	byteList, err := json.Marshal(actions)
+	filter, err := actionFilter(r)
 	if err != nil {
-		logrus.Error(err, "Error Unmashaling", "actions", byteList)
 		logrus.WithFields(logrus.Fields{
-			"Error":   err,
-			"actions": byteList,
-		}).Info("Error unmarshalling")
-		w.WriteHeader(http.StatusInternalServerError)
+			"Error": err,
+			"query": r.URL.RawQuery,
+		}).Info("Error parsing the filter")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	columns, err := selectColumns(r.URL.Query().Get("fields"))
+	if err == nil {
+		err = filter.Validate()
+	}
+	format, formatErr := exportFormat(r)
+	if err == nil {
+		err = formatErr
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	w.Header().Set("Content-Type", contentType(format))
 
-	if _, err := w.Write(byteList); err != nil {
+	// a page is read before it is written to tell the next cursor
+	// in a header, without a limit the actions are streamed
+	if filter.Limit > 0 {
+		actions, next, err := t.DB.QueryActions(filter)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if next != "" {
+			w.Header().Set(nextCursorHeader, next)
+		}
+		writeActions(w, format, columns, func(fn func(*statsdb.GitHubAction) error) error {
+			for i := range actions {
+				if err := fn(&actions[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return
+	}
+	writeActions(w, format, columns, func(fn func(*statsdb.GitHubAction) error) error {
+		_, err := t.DB.EachAction(filter, fn)
+		return err
+	})
+}
+
+// writeActions writes the actions of a source in a format,
+// flushing the response every few rows
+func writeActions(w http.ResponseWriter, format string, columns []exportColumn,
+	each func(func(*statsdb.GitHubAction) error) error) {
+	writer := newActionWriter(w, format, columns)
+	flusher, _ := w.(http.Flusher)
+	count := 0
+	err := each(func(action *statsdb.GitHubAction) error {
+		if err := writer.Write(action); err != nil {
+			return err
+		}
+		count++
+		if count%flushRows == 0 && flusher != nil {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && count == 0 {
+		// nothing is written yet, the status still tells the error
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
-		}).Info("Error writing response")
+		}).Error("Error reading actions")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		// the status is gone with the first row, the client
+		// sees a truncated response
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"rows":  count,
+		}).Error("Error writing response")
+	}
+}
+
+// actionFilter reads the filter of the actions from the query
+// parameters service, event, venture_reference, version, repository,
+// branch, commit_sha, pull_request, author, from, to, sort, limit
+// and cursor. The times are RFC 3339 times or dates.
+// A parameter payload.<key> selects the actions whose raw payload
+// has the value for the key, like payload.workflow.branch=main
+func actionFilter(r *http.Request) (statsdb.ActionFilter, error) {
+	query := r.URL.Query()
+	filter := statsdb.ActionFilter{
+		Service:          query.Get("service"),
+		Event:            query.Get("event"),
+		VentureReference: query.Get("venture_reference"),
+		Version:          query.Get("version"),
+		Repository:       query.Get("repository"),
+		Branch:           query.Get("branch"),
+		CommitSHA:        query.Get("commit_sha"),
+		Author:           query.Get("author"),
+		Sort:             query.Get("sort"),
+		Cursor:           query.Get("cursor"),
+	}
+	for name, values := range query {
+		if key := strings.TrimPrefix(name, payloadPrefix); key != name {
+			if filter.Payload == nil {
+				filter.Payload = map[string]string{}
+			}
+			filter.Payload[key] = values[0]
+		}
+	}
+	var err error
+	if filter.From, err = timeParam(r, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = timeParam(r, "to"); err != nil {
+		return filter, err
+	}
+	if value := query.Get("pull_request"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return filter, fmt.Errorf("bad pull_request %q", value)
+		}
+		filter.PullRequest = number
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		filter.Limit = limit
+	}
+	if filter.Cursor != "" && filter.Limit == 0 {
+		filter.Limit = defaultLimit
+	}
+	return filter, nil
+}
+
+// StatsActionAPI endpoint to the details of a stored action
+// served under /api/stats/{id}/tests, /api/stats/{id}/coverage
+// and /api/stats/{id}/suites
+func (t *Tracker) StatsActionAPI(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("tracker.StatsActionAPI")
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	fields := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/stats/"), "/"), "/")
+	if len(fields) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"URL":   r.URL.Path,
+		}).Info("Error parsing action id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch fields[1] {
+	case "tests":
+		writeJSON(w, t.DB.GetTestResults(id))
+	case "coverage":
+		writeJSON(w, t.DB.GetCoverage(id))
+	case "suites":
+		writeJSON(w, t.DB.GetTestSuites(id))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
 }
 
 // StatsWeb endpoint to StatsWeb
@@ -95,9 +289,13 @@ func (t *Tracker) StatsWeb(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	actions := t.DB.GetAllActions()
+	window := t.flakyWindow()
+	page := StatsPage{
+		Actions: t.DB.GetAllActions(),
+		Flaky:   flakyTests(t.DB.GetTestOutcomes("", window), window),
+	}
 
-	err := t.HTMLTemplate.ExecuteTemplate(w, t.HTMLTemplateName, actions)
+	err := t.HTMLTemplate.ExecuteTemplate(w, t.HTMLTemplateName, page)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
@@ -123,6 +321,14 @@ func (t *Tracker) Action(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if reason := t.verifySignature(r, body); reason != "" {
+		t.rejectAction(w, r, reason)
+		return
+	}
+	if event := r.Header.Get(githubEventHeader); event != "" {
+		t.githubWebhookAction(w, event, body)
+		return
+	}
 
 	action := &statsdb.GitHubAction{}
 	if err := json.Unmarshal(body, action); err != nil {
@@ -133,164 +339,263 @@ func (t *Tracker) Action(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if action.Payload == nil {
+		logrus.WithFields(logrus.Fields{
+			"body": string(body),
+		}).Info("Action without payload")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// the body is kept verbatim with the fields the action has no room for
+	action.Raw = json.RawMessage(body)
 
 	logrus.WithFields(logrus.Fields{
 		"Action":  action,
 		"Payload": action.Payload,
 	}).Info("Incoming")
-	err = t.DB.Save(action)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Error":  err,
-			"action": action,
-		}).Info("Error saving")
+	if err := t.saveAction(action); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	service := action.Payload.ServiceName
+	t.Wg.Add(1)
 	go func() {
-		localAction := getTestActions()
-		if localAction != nil {
+		defer t.Wg.Done()
+		localActions := getTestActions(service, t.testConfig(service))
+		for _, localAction := range localActions {
+			localAction.TriggerID = action.ID
+			if err := t.DB.Save(localAction); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"Error":  err,
+					"action": localAction,
+				}).Info("Error saving local action")
+			}
 			t.sendEvent(localAction)
 		}
+
+		if delta := coverageDelta(action, localActions); delta != nil {
+			if err := t.DB.SaveDelta(delta); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"Error": err,
+					"delta": delta,
+				}).Info("Error saving coverage delta")
+			}
+		}
 	}()
 
 	w.WriteHeader(http.StatusOK)
 }
 
-// EventSink go-routine to emit test events
-// it start the thead and returns a channel
-// where it expects to find test events
-func (t *Tracker) EventSink() chan<- string {
-	logrus.Info("tracker.EventSink")
-	c := make(chan string, queueSize)
-	t.Wg.Add(1)
-	go func() {
-		defer t.Wg.Done()
-		for {
-			action, flag := <-c
-			if flag {
-				logrus.WithFields(logrus.Fields{
-					"event": action,
-				}).Info("Sending test event")
-				resp, err := http.Post(t.DestEndpoint, "application/json", bytes.NewReader([]byte(action)))
-				if err != nil {
-					logrus.WithFields(logrus.Fields{
-						"Error": err,
-					}).Info("Error posting event")
-					continue
-				}
+// timeParam reads a query parameter holding an RFC 3339 time
+// or a date, which starts at midnight UTC. A missing parameter
+// returns the zero time
+func timeParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.Parse(dateLayout, value); err != nil {
+			return time.Time{}, fmt.Errorf("bad %s time %q", name, value)
+		}
+	}
+	return t, nil
+}
 
-				logrus.WithFields(logrus.Fields{
-					"event":    action,
-					"response": resp,
-				}).Info("Event Send")
-			} else {
-				logrus.Info("EventSink done")
-				return
-			}
+// saveAction stores an incoming action with the verdict
+// of the coverage policy of its service. An action without
+// coverage has nothing to check and keeps the last verdict
+func (t *Tracker) saveAction(action *statsdb.GitHubAction) error {
+	var verdict *statsdb.Verdict
+	if !action.Payload.NoCoverage {
+		verdict = t.evaluatePolicy(action)
+	}
+	if err := t.DB.Save(action); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":  err,
+			"action": action,
+		}).Info("Error saving")
+		return err
+	}
+	if verdict == nil {
+		return nil
+	}
+	verdict.ActionID = action.ID
+	if err := t.DB.SaveVerdict(verdict); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":   err,
+			"verdict": verdict,
+		}).Info("Error saving verdict")
+	}
+	return nil
+}
+
+// getTestActions runs the go test configured for a service and
+// generate test actions one for every package and one for the module total,
+// all of them with the repository, branch and commit of the checkout
+func getTestActions(service string, cfg TestConfig) []*statsdb.GitHubAction {
+	profile, err := ioutil.TempFile("", "tracker-*.coverprofile")
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error creating coverprofile")
+		return nil
+	}
+	profile.Close()
+	defer os.Remove(profile.Name())
+
+	args := cfg.Args(profile.Name())
+	logrus.WithFields(logrus.Fields{
+		"service": service,
+		"dir":     cfg.Dir,
+		"args":    args,
+	}).Info("trackerapi.runTestCmd")
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cfg.Command, args...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	exitCode := 0
+	err = cmd.Run()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":  err,
+			"stderr": stderr.String(),
+		}).Info("Error running test command")
+		exitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
 		}
-	}()
-	return c
+		if ctx.Err() == context.DeadlineExceeded {
+			fmt.Fprintf(&stderr, "test command timed out after %s\n", cfg.Timeout)
+		}
+	}
+	actions := testActions(service, out.Bytes(), stderr.Bytes(), exitCode, moduleName(cfg.Dir))
+	addCoverProfile(actions[len(actions)-1], cfg, profile.Name())
+	source := readGitSource(cfg.Dir)
+	for _, action := range actions {
+		source.apply(action)
+	}
+	return actions
 }
 
-// sendEvent format a test action to json
-// and pushes it on the event sink
-func (t *Tracker) sendEvent(action *statsdb.GitHubAction) {
-	buf, err := json.Marshal(action)
+// addCoverProfile adds the file and function coverage of a coverprofile
+// to the module action, which then gets the statement weighted total
+func addCoverProfile(total *statsdb.GitHubAction, cfg TestConfig, profile string) {
+	f, err := os.Open(profile)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
-		}).Info("Error unmarshalling")
+		}).Info("Error opening coverprofile")
 		return
 	}
-	t.Queue <- string(buf)
+	defer f.Close()
+
+	files, err := parseCoverProfile(f)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error parsing coverprofile")
+		return
+	}
+	if len(files) == 0 {
+		return
+	}
+	total.Payload.Files = files
+	total.Payload.Functions = coverFuncs(cfg, profile)
+	total.Payload.Coverage = totalCoverage(files)
 }
 
-// getTestAction runs the go test and generate test actions
-func getTestActions() *statsdb.GitHubAction {
-	logrus.Info("trackerapi.runTestCmd")
+// testActions generates the test actions of a finished test command.
+// A command which failed without reporting any package still produces
+// the module action, so a broken build gets recorded
+func testActions(service string, out, stderr []byte, exitCode int, module string) []*statsdb.GitHubAction {
+	actions := parseTestEvents(out).Actions(service, module)
+	if len(actions) == 0 {
+		action := newTestAction(service, module, 0)
+		action.Payload.Status = statusError
+		actions = append(actions, action)
+	}
 
-	cmd := exec.Command("go", "test", "-cover", "./...")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	total := actions[len(actions)-1]
+	if exitCode != 0 && total.Payload.Status == statusPass {
+		total.Payload.Status = statusFail
+	}
+	total.Payload.ExitCode = exitCode
+	if len(stderr) > maxStderr {
+		stderr = stderr[len(stderr)-maxStderr:]
+	}
+	total.Payload.Stderr = string(stderr)
+	return actions
+}
+
+// newTestAction creates a local test action for an event of a service
+func newTestAction(service, event string, coverage float64) *statsdb.GitHubAction {
+	return &statsdb.GitHubAction{
+		Event:            event,
+		VentureConfigId:  guuid.New().String(),
+		VentureReference: guuid.New().String(),
+		CreatedAt:        time.Now().UTC(),
+		Culture:          "en_EN",
+		ActionType:       "api",
+		ActionReference:  "",
+		Version:          "1.0.0",
+		Route:            "",
+		Payload: &statsdb.Payload{
+			ServiceName: service,
+			Coverage:    coverage,
+		},
+	}
+}
+
+// moduleName reads the module path from the go.mod file in dir
+func moduleName(dir string) string {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
-		}).Info("Error running test command")
-		return nil
+			"dir":   dir,
+		}).Info("Error reading go.mod")
+		return defaultModule
 	}
-	reader := bytes.NewReader(out.Bytes())
-	buf := bufio.NewReader(reader)
-	for {
-		linebytes, _, err := buf.ReadLine()
-		if err == io.EOF {
-			break
-		}
-		if fields := parseFields(linebytes); fields != nil {
-			return &statsdb.GitHubAction{
-				Event:            fields.action,
-				VentureConfigId:  guuid.New().String(),
-				VentureReference: guuid.New().String(),
-				CreatedAt:        "",
-				Culture:          "en_EN",
-				ActionType:       "api",
-				ActionReference:  "",
-				Version:          "1.0.0",
-				Route:            "",
-				Payload: &statsdb.Payload{
-					ServiceName: "tracker",
-					Coverage:    fields.coverage,
-				},
-			}
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
 		}
 	}
-	return nil
+	return defaultModule
 }
 
-// parseFields parses a line of a test coverage
-// to extract the package directory and the coverage weight
-func parseFields(linebytes []byte) *struct {
-	action   string
-	coverage float64
-} {
-	line := string(linebytes)
-	fields := strings.Split(line, "\t")
-	if len(fields) > 3 && strings.TrimSpace(fields[0]) == "ok" {
-		if beg := strings.Index(fields[3], "coverage"); beg != -1 {
-			beg += len("coverage") + 1
-			if end := strings.Index(fields[3][beg:], "%"); end != -1 {
-				action := fields[1]
-				coverage := strings.TrimSpace(fields[3][beg : beg+end])
-				coverage_val, err := strconv.ParseFloat(coverage, 64)
-				if err != nil {
-					logrus.WithFields(logrus.Fields{
-						"Error": err,
-						"value": coverage,
-					}).Info("Could not convert coverage")
-					return nil
-				}
-				logrus.WithFields(logrus.Fields{
-					"event":    action,
-					"coverage": coverage_val,
-				}).Info("Test")
-				return &struct {
-					action   string
-					coverage float64
-				}{
-					action:   action,
-					coverage: coverage_val,
-				}
-			}
-		}
+// writeJSON marshals a value as the json body of a response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	byteList, err := json.Marshal(v)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error marshalling")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(byteList); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Info("Error writing response")
 	}
-	return nil
 }
 
 // rangeStructer takes the first argument, which must be a struct, and
-// returns the value of each field in a slice. It will return nil
-// if there are no arguments or first argument is not a struct
+// returns the value of each field in a slice, leaving out the fields
+// tagged html:"-". It will return nil if there are no arguments
+// or first argument is not a struct
 func rangeStructer(args ...interface{}) []interface{} {
 	if len(args) == 0 {
 		return nil
@@ -301,9 +606,12 @@ func rangeStructer(args ...interface{}) []interface{} {
 		return nil
 	}
 
-	out := make([]interface{}, v.NumField())
+	out := []interface{}{}
 	for i := 0; i < v.NumField(); i++ {
-		out[i] = v.Field(i).Interface()
+		if v.Type().Field(i).Tag.Get("html") == "-" {
+			continue
+		}
+		out = append(out, v.Field(i).Interface())
 	}
 
 	return out
@@ -2,41 +2,59 @@ package trackerapi
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
 	"net/http/httptest"
 	"ringier/pkg/statsdb"
+	"strings"
 	"sync"
 	"testing"
 )
 
-// TestTrackerApi_parseFields checks if a line of a test coverage
-// can be parsed correctly
-func TestTrackerApi_parseFields(t *testing.T) {
+// TestTrackerApi_testActions checks if failed and non compiling
+// test runs still produce test actions
+func TestTrackerApi_testActions(t *testing.T) {
 	testCases := []struct {
-		line []byte
-		want *struct {
-			action   string
-			coverage float64
-		}
+		out      []byte
+		stderr   []byte
+		exitCode int
+		actions  int
+		status   string
 	}{
 		{
-			line: []byte("ok\tringier/pkg/statsdb\t(cached)\tcoverage: 63.3% of statements"),
-			want: &struct {
-				action   string
-				coverage float64
-			}{
-				action:   "ringier/pkg/statsdb",
-				coverage: 63.6,
-			},
+			out:      []byte(testEvents),
+			exitCode: 1,
+			actions:  4,
+			status:   statusFail,
+		},
+		{
+			out:      []byte(`{"Action":"pass","Package":"ringier/pkg/statsdb","Elapsed":0}`),
+			stderr:   []byte("go: warning\n"),
+			exitCode: 2,
+			actions:  2,
+			status:   statusFail,
+		},
+		{
+			stderr:   []byte("go: cannot find main module\n"),
+			exitCode: 1,
+			actions:  1,
+			status:   statusError,
 		},
 	}
 
 	for _, tc := range testCases {
-		got := parseFields(tc.line)
-		if got == nil || got.action != tc.want.action && got.coverage != tc.want.coverage {
-			t.Errorf("parseFields(%q): want: %v, got: %v", string(tc.line), tc.want, got)
+		got := testActions("test", tc.out, tc.stderr, tc.exitCode, "ringier")
+		if len(got) != tc.actions {
+			t.Errorf("testActions(%q): want: %v actions, got: %v", string(tc.stderr), tc.actions, len(got))
+			continue
+		}
+		total := got[len(got)-1]
+		if total.Event != "ringier" || total.Payload.ServiceName != "test" || total.Payload.Status != tc.status ||
+			total.Payload.ExitCode != tc.exitCode || total.Payload.Stderr != string(tc.stderr) {
+			t.Errorf("testActions(%q): want: %v %v %q, got: %v", string(tc.stderr), tc.status, tc.exitCode, string(tc.stderr), total.Payload)
 		}
 	}
 }
@@ -63,11 +81,21 @@ func TestTrackerApi_runTestCmd(t *testing.T) {
 	defer server.Close()
 
 	tracker := &Tracker{Wg: sync.WaitGroup{}}
-	defer tracker.Wg.Wait()
-	tracker.Queue = tracker.EventSink()
-	defer close(tracker.Queue)
+	tracker.DB = statsdb.NewMemStore()
 	tracker.DestEndpoint = server.URL
+	if err := tracker.SetupSinks(); err != nil {
+		t.Errorf("Error setting up sinks: %v", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker.Queue = tracker.EventSink(ctx)
 	tracker.sendEvent(&statsdb.GitHubAction{})
+	cancel()
+	tracker.Wg.Wait()
+
+	if pending := tracker.DB.GetOutbox(statsdb.OutboxPending); len(pending) != 0 {
+		t.Errorf("Tracker.sendEvent(): want: %v pending events, got: %v", 0, len(pending))
+	}
 }
 
 // TestTrackerApi_StatsAPI checks if the api endpoint
@@ -75,15 +103,7 @@ func TestTrackerApi_runTestCmd(t *testing.T) {
 func TestTrackerApi_StatsAPI(t *testing.T) {
 	tracker := &Tracker{Wg: sync.WaitGroup{}}
 	defer tracker.Wg.Wait()
-	tracker.DB = statsdb.Open("./test.db")
-	if tracker.DB == nil {
-		return
-	}
-	err := tracker.DB.Setup()
-	if err != nil {
-		t.Errorf("Error setting up database: %v", err)
-		return
-	}
+	tracker.DB = statsdb.NewMemStore()
 
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest(http.MethodGet, "/stats/api", nil)
@@ -94,6 +114,116 @@ func TestTrackerApi_StatsAPI(t *testing.T) {
 	}
 }
 
+// TestTrackerApi_StatsAPIFilter checks the query parameters
+// and the pages of the api endpoint
+func TestTrackerApi_StatsAPIFilter(t *testing.T) {
+	tracker := &Tracker{Wg: sync.WaitGroup{}}
+	tracker.DB = statsdb.NewMemStore()
+	for _, service := range []string{"shop", "search", "shop"} {
+		raw := json.RawMessage(`{"runner":"linux","workflow":{"branch":"` + service + `"}}`)
+		action := &statsdb.GitHubAction{Event: "push", Branch: "main", Payload: &statsdb.Payload{ServiceName: service}, Raw: raw}
+		if service == "search" {
+			action.Branch, action.PullRequest = "feature", 412
+		}
+		if err := tracker.DB.Save(action); err != nil {
+			t.Errorf("Error saving action: %v", err)
+			return
+		}
+	}
+
+	testCases := []struct {
+		query   string
+		want    int
+		actions int
+		next    bool
+	}{
+		{query: "", want: http.StatusOK, actions: 3},
+		{query: "service=shop&event=push&sort=-id", want: http.StatusOK, actions: 2},
+		{query: "limit=2", want: http.StatusOK, actions: 2, next: true},
+		{query: "from=2021-03-01&to=2021-03-02T00:00:00Z", want: http.StatusOK},
+		{query: "from=yesterday", want: http.StatusBadRequest},
+		{query: "limit=0", want: http.StatusBadRequest},
+		{query: "limit=5000", want: http.StatusBadRequest},
+		{query: "sort=name", want: http.StatusBadRequest},
+		{query: "cursor=abc", want: http.StatusBadRequest},
+		{query: "payload.runner=linux", want: http.StatusOK, actions: 3},
+		{query: "payload.runner=linux&payload.workflow.branch=search", want: http.StatusOK, actions: 1},
+		{query: "payload.workflow.branch=main", want: http.StatusOK},
+		{query: "payload.workflow..branch=main", want: http.StatusBadRequest},
+		{query: "branch=main&sort=created_at", want: http.StatusOK, actions: 2},
+		{query: "pull_request=412", want: http.StatusOK, actions: 1},
+		{query: "pull_request=pr", want: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		tracker.StatsAPI(w, httptest.NewRequest(http.MethodGet, "/api/stats?"+tc.query, nil))
+		resp := w.Result()
+		if resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.StatsAPI(%q): want: %v, got: %v", tc.query, tc.want, resp.StatusCode)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		actions := []statsdb.GitHubAction{}
+		if err := json.NewDecoder(resp.Body).Decode(&actions); err != nil || len(actions) != tc.actions {
+			t.Errorf("trackerapi.StatsAPI(%q): want: %v actions, got: %v %v", tc.query, tc.actions, len(actions), err)
+		}
+		next := resp.Header.Get(nextCursorHeader)
+		if (next != "") != tc.next {
+			t.Errorf("trackerapi.StatsAPI(%q): want: next page %v, got: %q", tc.query, tc.next, next)
+		}
+		if next == "" {
+			continue
+		}
+
+		w = httptest.NewRecorder()
+		tracker.StatsAPI(w, httptest.NewRequest(http.MethodGet, "/api/stats?limit=2&cursor="+next, nil))
+		actions = []statsdb.GitHubAction{}
+		if err := json.NewDecoder(w.Result().Body).Decode(&actions); err != nil || len(actions) != 1 {
+			t.Errorf("trackerapi.StatsAPI(cursor): want: %v action, got: %v %v", 1, len(actions), err)
+		}
+	}
+}
+
+// TestTrackerApi_StatsActionAPI checks if the test results
+// and the coverage of a stored action are served
+func TestTrackerApi_StatsActionAPI(t *testing.T) {
+	tracker := &Tracker{Wg: sync.WaitGroup{}}
+	defer tracker.Wg.Wait()
+	tracker.DB = statsdb.NewMemStore()
+	action := &statsdb.GitHubAction{Payload: &statsdb.Payload{
+		ServiceName: "test",
+		Tests:       []statsdb.TestResult{{Package: "test", Name: "TestA", Status: "pass"}},
+	}}
+	if err := tracker.DB.Save(action); err != nil {
+		t.Errorf("Error saving action: %v", err)
+		return
+	}
+
+	testCases := []struct {
+		path string
+		want int
+	}{
+		{path: fmt.Sprintf("/api/stats/%d/tests", action.ID), want: http.StatusOK},
+		{path: fmt.Sprintf("/api/stats/%d/coverage", action.ID), want: http.StatusOK},
+		{path: fmt.Sprintf("/api/stats/%d/suites", action.ID), want: http.StatusOK},
+		{path: "/api/stats/abc/tests", want: http.StatusBadRequest},
+		{path: fmt.Sprintf("/api/stats/%d/unknown", action.ID), want: http.StatusNotFound},
+		{path: "/api/stats/", want: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		tracker.StatsActionAPI(w, r)
+		if resp := w.Result(); resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.StatsActionAPI(%q): want: %v, got: %v", tc.path, tc.want, resp.StatusCode)
+		}
+	}
+}
+
 var tmplStr string = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN"                            
 "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">                                
 <html xmlns="http://www.w3.org/1999/xhtml">                                         
@@ -107,21 +237,49 @@ var tmplStr string = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN"
     <table summary="Test Statistics">                                               
       <caption>Test Statistics</caption>                                            
       <tr>                                                                          
+        <th>Id</th>
         <th>Event</th>                                                              
         <th>VentureConfigId</th>                                                    
         <th>VentureReference</th>                                                   
         <th>CreatedAt</th>                                                          
+        <th>ReceivedAt</th>
         <th>Culture</th>                                                            
         <th>ActionType</th>                                                         
         <th>ActionReference</th>                                                    
         <th>Version</th>                                                            
-        <th>Route</th>                                                              
-        <th>Payload</th>                                                            
+        <th>Route</th>
+        <th>Repository</th>
+        <th>Branch</th>
+        <th>CommitSHA</th>
+        <th>PullRequest</th>
+        <th>Author</th>                                                              
+        <th>Payload</th>
+        <th>TriggerId</th>
+        <th>Delta</th>                                                            
+        <th>Workflow</th>
+        <th>Tests</th>
       </tr>                                                                         
-      {{range .}}<tr>                                                               
+      {{range .Actions}}<tr>                                                               
       {{range rangeStruct .}}<td>{{.}}</td>                                         
       {{end}}</tr>                                                                  
       {{end}}                                                                       
+    </table>
+    <table summary="Flaky Tests">
+      <caption>Flaky Tests</caption>
+      <tr>
+        <th>Service</th>
+        <th>Package</th>
+        <th>Test</th>
+        <th>Runs</th>
+        <th>Failures</th>
+        <th>Flips</th>
+        <th>FlakyCommits</th>
+        <th>Score</th>
+      </tr>
+      {{range .Flaky}}<tr>
+      {{range rangeStruct .}}<td>{{.}}</td>
+      {{end}}</tr>
+      {{end}}
     </table>                                                                        
   </body>                                                                           
 </html> `
@@ -131,17 +289,10 @@ var tmplStr string = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN"
 func TestTrackerApi_StatsWeb(t *testing.T) {
 	tracker := &Tracker{Wg: sync.WaitGroup{}}
 	defer tracker.Wg.Wait()
-	tracker.DB = statsdb.Open("./test.db")
-	if tracker.DB == nil {
-		return
-	}
-	err := tracker.DB.Setup()
-	if err != nil {
-		t.Errorf("Error setting up database: %v", err)
-		return
-	}
+	tracker.DB = statsdb.NewMemStore()
 	templ := template.New("test.tmpl").Funcs(TemplateFuncs)
 	tracker.HTMLTemplateName = "test.tmpl"
+	var err error
 	tracker.HTMLTemplate, err = templ.Parse(tmplStr)
 	if err != nil {
 		t.Error(err, "Error parsing the web template")
@@ -156,6 +307,19 @@ func TestTrackerApi_StatsWeb(t *testing.T) {
 	}
 }
 
+// TestTrackerApi_rangeStructer checks if the fields
+// hidden from the web page are left out
+func TestTrackerApi_rangeStructer(t *testing.T) {
+	action := statsdb.GitHubAction{ID: 1, Raw: json.RawMessage(`{"runner":"linux"}`)}
+	fields := rangeStructer(action)
+	if want := strings.Count(tmplStr, "<th>") - 8; len(fields) != want || fields[0] != int64(1) {
+		t.Errorf("rangeStructer(): want: %v fields, got: %v", want, fields)
+	}
+	if fields := rangeStructer("action"); fields != nil {
+		t.Errorf("rangeStructer(): want: %v, got: %v", nil, fields)
+	}
+}
+
 var githubAction string = `{
 	"event": "TrackTestCoverageEvent",
 	"venture_config_id": "57EFFB23-1731-4348-B306-9F3819D12FEB",
@@ -166,6 +330,7 @@ var githubAction string = `{
 	"action_reference": "",
 	"version": "1.0.0",
 	"route": "",
+	"runner": "ubuntu-latest",
 	"payload": {
 			"service_name": "test",
 			"coverage": 23.5
@@ -183,18 +348,16 @@ func TestTrackerApi_getTestActions(t *testing.T) {
 
 	tracker := &Tracker{Wg: sync.WaitGroup{}}
 	defer tracker.Wg.Wait()
-	tracker.DB = statsdb.Open("./test.db")
-	if tracker.DB == nil {
-		return
-	}
-	err := tracker.DB.Setup()
-	if err != nil {
-		t.Errorf("Error setting up database: %v", err)
+	tracker.DB = statsdb.NewMemStore()
+	tracker.DestEndpoint = server.URL
+	tracker.Services = map[string]TestConfig{"test": {Command: "true"}}
+	if err := tracker.SetupSinks(); err != nil {
+		t.Errorf("Error setting up sinks: %v", err)
 		return
 	}
-	tracker.Queue = tracker.EventSink()
-	defer close(tracker.Queue)
-	tracker.DestEndpoint = server.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tracker.Queue = tracker.EventSink(ctx)
 
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest(http.MethodPost, "/action", bytes.NewReader([]byte(githubAction)))
@@ -203,4 +366,24 @@ func TestTrackerApi_getTestActions(t *testing.T) {
 	if resp.Status != fmt.Sprintf("%d OK", http.StatusOK) {
 		t.Errorf("trackerapi.Action(w http.ResponseWriter, r *http.Request): want: %v, got: %v", http.StatusOK, resp.Status)
 	}
+
+	actions, _, err := tracker.DB.QueryActions(statsdb.ActionFilter{Payload: map[string]string{"runner": "ubuntu-latest"}, Sort: "-id", Limit: 1})
+	if err != nil || len(actions) != 1 || string(actions[0].Raw) != githubAction {
+		t.Errorf("trackerapi.Action(): want: the raw body, got: %v %v", actions, err)
+	}
+}
+
+// TestTrackerApi_ActionCreatedAt checks if an action
+// with a created_at time which is not RFC 3339 is rejected
+func TestTrackerApi_ActionCreatedAt(t *testing.T) {
+	tracker := &Tracker{Wg: sync.WaitGroup{}}
+	for _, createdAt := range []string{`""`, `"yesterday"`, `"2021-03-02 08:30:00"`, `1614673800`} {
+		body := strings.Replace(githubAction, `"2021-03-02T08:30:00+00:00"`, createdAt, 1)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/action", strings.NewReader(body))
+		tracker.Action(w, r)
+		if resp := w.Result(); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("trackerapi.Action(created_at: %s): want: %v, got: %v", createdAt, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
 }
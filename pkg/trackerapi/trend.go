@@ -0,0 +1,47 @@
+package trackerapi
+
+import (
+	"net/http"
+	"ringier/pkg/statsdb"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultBucket = "day"
+
+// TrendAPI endpoint to the coverage of the services by time bucket
+// GET /api/stats/trend?service=name&bucket=hour|day|week|month&from=&to=
+// Without a service every service gets its own points
+func (t *Tracker) TrendAPI(w http.ResponseWriter, r *http.Request) {
+	logrus.Info("tracker.TrendAPI")
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = defaultBucket
+	}
+	from, err := timeParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := timeParam(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	points, err := t.DB.CoverageTrend(r.URL.Query().Get("service"), bucket, from, to)
+	if err == statsdb.ErrBadBucket {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, points)
+}
@@ -0,0 +1,59 @@
+package trackerapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"ringier/pkg/statsdb"
+	"testing"
+	"time"
+)
+
+// TestTrackerApi_TrendAPI checks if the api endpoint returns
+// the coverage trend of the services
+func TestTrackerApi_TrendAPI(t *testing.T) {
+	tracker := &Tracker{}
+	tracker.DB = statsdb.NewMemStore()
+	for _, action := range []*statsdb.GitHubAction{
+		{CreatedAt: time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC), Payload: &statsdb.Payload{ServiceName: "shop", Coverage: 50}},
+		{CreatedAt: time.Date(2021, 3, 2, 8, 0, 0, 0, time.UTC), Payload: &statsdb.Payload{ServiceName: "shop", Coverage: 60}},
+		{CreatedAt: time.Date(2021, 3, 2, 9, 0, 0, 0, time.UTC), Payload: &statsdb.Payload{ServiceName: "search", Coverage: 70}},
+	} {
+		if err := tracker.DB.Save(action); err != nil {
+			t.Errorf("Error saving action: %v", err)
+			return
+		}
+	}
+
+	testCases := []struct {
+		method string
+		query  string
+		want   int
+		points int
+	}{
+		{method: http.MethodGet, query: "service=shop", want: http.StatusOK, points: 2},
+		{method: http.MethodGet, query: "service=shop&bucket=month", want: http.StatusOK, points: 1},
+		{method: http.MethodGet, query: "bucket=day", want: http.StatusOK, points: 3},
+		{method: http.MethodGet, query: "from=2021-03-02", want: http.StatusOK, points: 2},
+		{method: http.MethodGet, query: "bucket=year", want: http.StatusBadRequest},
+		{method: http.MethodGet, query: "to=tomorrow", want: http.StatusBadRequest},
+		{method: http.MethodPost, query: "", want: http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		tracker.TrendAPI(w, httptest.NewRequest(tc.method, "/api/stats/trend?"+tc.query, nil))
+		resp := w.Result()
+		if resp.StatusCode != tc.want {
+			t.Errorf("trackerapi.TrendAPI(%s %q): want: %v, got: %v", tc.method, tc.query, tc.want, resp.StatusCode)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		points := []statsdb.TrendPoint{}
+		if err := json.NewDecoder(resp.Body).Decode(&points); err != nil || len(points) != tc.points {
+			t.Errorf("trackerapi.TrendAPI(%q): want: %v points, got: %v %v", tc.query, tc.points, points, err)
+		}
+	}
+}